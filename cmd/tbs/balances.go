@@ -1,17 +1,34 @@
 package main
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/jTanG0506/go-blockchain/database"
+	"github.com/jTanG0506/go-blockchain/node"
 	"github.com/spf13/cobra"
 )
 
+const outputText = "text"
+const outputJSON = "json"
+const outputCSV = "csv"
+
+type balancesOutput struct {
+	Hash     database.Hash     `json:"block_hash"`
+	Number   uint64            `json:"block_number"`
+	Accounts []node.BalanceRes `json:"accounts"`
+}
+
 func balancesCmd() *cobra.Command {
 	var balancesCmd = &cobra.Command{
 		Use:   "balances",
-		Short: "Interact with balances (list...)",
+		Short: "Interact with balances (list, get...)",
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			return incorrectUsageErr()
 		},
@@ -21,36 +38,209 @@ func balancesCmd() *cobra.Command {
 	}
 
 	balancesCmd.AddCommand(balancesListCmd())
+	balancesCmd.AddCommand(balancesGetCmd())
 	return balancesCmd
 }
 
 func balancesListCmd() *cobra.Command {
 	var balancesListCmd = &cobra.Command{
 		Use:   "list",
-		Short: "List all balances",
+		Short: "List all balances and nonces",
 		Run: func(cmd *cobra.Command, args []string) {
-			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd))
+			output, err := getOutputFromCmd(cmd)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			state, err := loadBalancesState(cmd)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
 				os.Exit(1)
 			}
 			defer state.Close()
 
-			fmt.Println("Account Balances")
-			fmt.Println("----------------")
-			for account, balance := range state.Balances {
-				fmt.Printf("%s: %d\n", account.String(), balance)
+			accounts := make([]node.BalanceRes, 0)
+			for _, account := range sortedAccounts(state) {
+				accounts = append(accounts, accountBalance(state, account))
 			}
 
-			fmt.Println("")
-			fmt.Println("Account Nonces")
-			fmt.Println("----------------")
-			for account, balance := range state.Balances {
-				fmt.Printf("%s: %d\n", account.String(), balance)
+			out := balancesOutput{state.LatestBlockHash(), state.LastBlock().Header.Number, accounts}
+			err = printBalances(output, out)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
 			}
 		},
 	}
 
-	addDefaultRequiredFlags(balancesListCmd)
+	addBalancesFlags(balancesListCmd)
 	return balancesListCmd
 }
+
+func balancesGetCmd() *cobra.Command {
+	var balancesGetCmd = &cobra.Command{
+		Use:   "get <account>",
+		Short: "Show the balance and nonce of an account",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if !common.IsHexAddress(args[0]) {
+				fmt.Fprintf(os.Stderr, "'%s' is an invalid account\n", args[0])
+				os.Exit(1)
+			}
+
+			output, err := getOutputFromCmd(cmd)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			state, err := loadBalancesState(cmd)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer state.Close()
+
+			err = printBalance(output, accountBalance(state, database.NewAccount(args[0])))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	addBalancesFlags(balancesGetCmd)
+	return balancesGetCmd
+}
+
+func addBalancesFlags(cmd *cobra.Command) {
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().Uint64(flagAtHeight, 0, "show balances as of the block with this number instead of the latest block")
+	cmd.Flags().String(flagOutput, outputText, "output format: 'text', 'json' or 'csv'")
+}
+
+// loadBalancesState loads the latest state, or recomputes the state as of
+// the --at-height block
+func loadBalancesState(cmd *cobra.Command) (*database.State, error) {
+	if cmd.Flags().Changed(flagAtHeight) {
+		height, _ := cmd.Flags().GetUint64(flagAtHeight)
+		return database.StateAt(getDataDirFromCmd(cmd), height)
+	}
+
+	return database.NewStateFromDisk(getDataDirFromCmd(cmd))
+}
+
+func sortedAccounts(state *database.State) []common.Address {
+	accounts := make([]common.Address, 0, len(state.Balances))
+	for account := range state.Balances {
+		accounts = append(accounts, account)
+	}
+
+	for account := range state.AccountsToNonce {
+		if _, ok := state.Balances[account]; !ok {
+			accounts = append(accounts, account)
+		}
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return bytes.Compare(accounts[i].Bytes(), accounts[j].Bytes()) < 0
+	})
+
+	return accounts
+}
+
+func accountBalance(state *database.State, account common.Address) node.BalanceRes {
+	return node.BalanceRes{
+		Hash:    state.LatestBlockHash(),
+		Number:  state.LastBlock().Header.Number,
+		Account: account,
+		Balance: state.Balances[account],
+		Nonce:   state.AccountsToNonce[account],
+	}
+}
+
+func getOutputFromCmd(cmd *cobra.Command) (string, error) {
+	output, _ := cmd.Flags().GetString(flagOutput)
+
+	switch output {
+	case outputText, outputJSON, outputCSV:
+		return output, nil
+	default:
+		return "", fmt.Errorf("unknown output format '%s', expected '%s', '%s' or '%s'", output, outputText, outputJSON, outputCSV)
+	}
+}
+
+func printBalances(output string, out balancesOutput) error {
+	switch output {
+	case outputJSON:
+		return printJSON(out)
+	case outputCSV:
+		return printBalancesCSV(out.Accounts)
+	}
+
+	if !out.Hash.IsEmpty() {
+		fmt.Printf("Block %d (%s)\n", out.Number, out.Hash.Hex())
+		fmt.Println("")
+	}
+
+	fmt.Println("Account Balances")
+	fmt.Println("----------------")
+	for _, account := range out.Accounts {
+		fmt.Printf("%s: %d\n", account.Account.String(), account.Balance)
+	}
+
+	fmt.Println("")
+	fmt.Println("Account Nonces")
+	fmt.Println("----------------")
+	for _, account := range out.Accounts {
+		fmt.Printf("%s: %d\n", account.Account.String(), account.Nonce)
+	}
+
+	return nil
+}
+
+func printBalance(output string, balance node.BalanceRes) error {
+	switch output {
+	case outputJSON:
+		return printJSON(balance)
+	case outputCSV:
+		return printBalancesCSV([]node.BalanceRes{balance})
+	}
+
+	if !balance.Hash.IsEmpty() {
+		fmt.Printf("Block %d (%s)\n", balance.Number, balance.Hash.Hex())
+	}
+	fmt.Printf("Account: %s\n", balance.Account.String())
+	fmt.Printf("Balance: %d\n", balance.Balance)
+	fmt.Printf("Nonce:   %d\n", balance.Nonce)
+
+	return nil
+}
+
+func printJSON(content interface{}) error {
+	contentJson, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(contentJson))
+	return nil
+}
+
+func printBalancesCSV(balances []node.BalanceRes) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"account", "balance", "nonce", "block_number", "block_hash"})
+	for _, balance := range balances {
+		w.Write([]string{
+			balance.Account.String(),
+			strconv.FormatUint(uint64(balance.Balance), 10),
+			strconv.FormatUint(uint64(balance.Nonce), 10),
+			strconv.FormatUint(balance.Number, 10),
+			balance.Hash.Hex(),
+		})
+	}
+
+	w.Flush()
+	return w.Error()
+}
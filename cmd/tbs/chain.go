@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/jTanG0506/go-blockchain/database"
+	"github.com/jTanG0506/go-blockchain/fs"
+	"github.com/spf13/cobra"
+)
+
+func chainCmd() *cobra.Command {
+	var chainCmd = &cobra.Command{
+		Use:   "chain",
+		Short: "Exports and imports blocks to seed nodes from a file (export, import...)",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	chainCmd.AddCommand(chainExportCmd())
+	chainCmd.AddCommand(chainImportCmd())
+	return chainCmd
+}
+
+func chainExportCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "export",
+		Short: "Exports blocks to a compressed, checksummed file",
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+			from, _ := cmd.Flags().GetUint64(flagFrom)
+			to, _ := cmd.Flags().GetUint64(flagTo)
+			out, _ := cmd.Flags().GetString(flagOut)
+			out = fs.ExpandPath(out)
+
+			if !cmd.Flags().Changed(flagTo) {
+				to = math.MaxUint64
+			}
+
+			f, err := os.Create(out)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			trailer, err := database.ExportBlocks(dataDir, from, to, f)
+			if err == nil {
+				err = f.Close()
+			}
+
+			if err != nil {
+				f.Close()
+				os.Remove(out)
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Exported %d blocks, %d to %d, to '%s'\n", trailer.Blocks, from, trailer.To, out)
+			fmt.Printf("SHA-256: %s\n", trailer.Checksum)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().Uint64(flagFrom, 0, "number of the first block to export")
+	cmd.Flags().Uint64(flagTo, 0, "number of the last block to export (default the latest block)")
+	cmd.Flags().String(flagOut, "", "file to export the blocks to")
+	cmd.MarkFlagRequired(flagOut)
+
+	return cmd
+}
+
+func chainImportCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "import",
+		Short: "Validates and adds the blocks of an export, skipping those the node already has. Stop the node first.",
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+			in, _ := cmd.Flags().GetString(flagIn)
+
+			report, err := database.ImportBlocks(dataDir, fs.ExpandPath(in))
+			if err != nil {
+				if report.Imported > 0 {
+					fmt.Printf("Imported %d blocks before failing, run the import again to resume\n", report.Imported)
+				}
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Imported %d blocks, skipped %d the node already had\n", report.Imported, report.Skipped)
+			fmt.Printf("Height: %d\n", report.Height)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagIn, "", "chain export to import")
+	cmd.MarkFlagRequired(flagIn)
+
+	return cmd
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/jTanG0506/go-blockchain/fs"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+const envVarPrefix = "TBS_"
+
+// nodeConfigFileName is the config file `tbs init` writes into the data dir
+const nodeConfigFileName = "config.toml"
+
+func addConfigFlag(cmd *cobra.Command) {
+	cmd.Flags().String(flagConfig, "", "TOML or YAML config file whose keys are the flag names, e.g. mining-policy")
+}
+
+// applyConfig fills every flag which wasn't set on the command line, first
+// from its TBS_* environment variable, e.g. TBS_MINING_POLICY, then from the
+// config file. Flags take precedence over environment variables, which take
+// precedence over the config file.
+func applyConfig(cmd *cobra.Command) error {
+	configPath, _ := cmd.Flags().GetString(flagConfig)
+	if !cmd.Flags().Changed(flagConfig) {
+		configPath = os.Getenv(envVarName(flagConfig))
+	}
+
+	config := make(map[string]interface{})
+	if configPath != "" {
+		var err error
+		config, err = loadConfigFile(fs.ExpandPath(configPath))
+		if err != nil {
+			return err
+		}
+	}
+
+	for key := range config {
+		if key == flagConfig || cmd.Flags().Lookup(key) == nil {
+			return fmt.Errorf("unknown key '%s' in config file '%s'", key, configPath)
+		}
+	}
+
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || f.Name == flagConfig {
+			return
+		}
+
+		if value, isSet := os.LookupEnv(envVarName(f.Name)); isSet {
+			err = setFlagFromConfig(cmd, f.Name, value, envVarName(f.Name))
+			return
+		}
+
+		if rawValue, isSet := config[f.Name]; isSet {
+			var value string
+			value, err = configValueToString(rawValue)
+			if err != nil {
+				err = fmt.Errorf("invalid value for '%s' in config file '%s'. %s", f.Name, configPath, err.Error())
+				return
+			}
+
+			err = setFlagFromConfig(cmd, f.Name, value, configPath)
+		}
+	})
+
+	return err
+}
+
+func loadConfigFile(path string) (map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(content, &config)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &config)
+	default:
+		return nil, fmt.Errorf("config file '%s' must be a .toml, .yaml or .yml file", path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config file '%s'. %s", path, err.Error())
+	}
+
+	return config, nil
+}
+
+// writeNodeConfig writes the given flag values as a TOML config file which
+// `tbs run --config` reads, refusing to overwrite an existing file
+func writeNodeConfig(path string, config map[string]interface{}) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to create config file '%s'. %s", path, err.Error())
+	}
+	defer f.Close()
+
+	err = toml.NewEncoder(f).Encode(config)
+	if err != nil {
+		return fmt.Errorf("unable to write config file '%s'. %s", path, err.Error())
+	}
+
+	return nil
+}
+
+func configValueToString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, item := range v {
+			itemValue, err := configValueToString(item)
+			if err != nil {
+				return "", err
+			}
+
+			values[i] = itemValue
+		}
+
+		return strings.Join(values, ","), nil
+	case map[string]interface{}, map[interface{}]interface{}:
+		return "", fmt.Errorf("nested tables aren't supported")
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+func setFlagFromConfig(cmd *cobra.Command, name, value, source string) error {
+	err := cmd.Flags().Set(name, value)
+	if err != nil {
+		return fmt.Errorf("invalid value '%s' for '%s' from '%s'. %s", value, name, source, err.Error())
+	}
+
+	return nil
+}
+
+func envVarName(flagName string) string {
+	return envVarPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
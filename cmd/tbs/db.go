@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jTanG0506/go-blockchain/database"
+	"github.com/spf13/cobra"
+)
+
+func dbCmd() *cobra.Command {
+	var dbCmd = &cobra.Command{
+		Use:   "db",
+		Short: "Checks and repairs a node's blocks DB (verify, truncate...)",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	dbCmd.AddCommand(dbVerifyCmd())
+	dbCmd.AddCommand(dbTruncateCmd())
+	return dbCmd
+}
+
+func dbVerifyCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "verify",
+		Short: "Replays every block on top of the genesis and reports the first invalid one",
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+
+			report, err := database.VerifyDataDir(dataDir)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			printChainReport(report)
+			if report.BadBlock == nil {
+				return
+			}
+
+			bad := report.BadBlock
+			fmt.Println("")
+			fmt.Println("Bad block:")
+			fmt.Printf("  height: %d\n", bad.Number)
+			fmt.Printf("  hash:   %s\n", bad.Hash.Hex())
+			fmt.Printf("  offset: %d\n", bad.Offset)
+			fmt.Printf("  reason: %s\n", bad.Reason)
+			fmt.Printf("  error:  %s\n", bad.Err.Error())
+
+			if report.Blocks > 0 {
+				fmt.Println("")
+				fmt.Printf("Cut the chain back to its valid prefix with 'tbs db truncate --%s %s --%s %d'\n", flagDataDir, dataDir, flagToHeight, report.Height)
+			}
+
+			os.Exit(1)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	return cmd
+}
+
+func dbTruncateCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "truncate",
+		Short: "Removes every block above the given height so the node re-syncs them. Stop the node first.",
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+			height, _ := cmd.Flags().GetUint64(flagToHeight)
+
+			report, err := database.TruncateDataDir(dataDir, height)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Truncated blocks DB of '%s' to height %d\n", dataDir, height)
+			printChainReport(report)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().Uint64(flagToHeight, 0, "height of the last block to keep")
+	cmd.MarkFlagRequired(flagToHeight)
+
+	return cmd
+}
+
+func printChainReport(report database.ChainReport) {
+	if report.Blocks == 0 {
+		fmt.Println("No valid blocks")
+		return
+	}
+
+	fmt.Printf("Valid blocks: %d\n", report.Blocks)
+	fmt.Printf("Height:       %d\n", report.Height)
+	fmt.Printf("Last hash:    %s\n", report.LastHash.Hex())
+}
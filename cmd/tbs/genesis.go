@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jTanG0506/go-blockchain/database"
+	"github.com/jTanG0506/go-blockchain/fs"
+	"github.com/spf13/cobra"
+)
+
+func genesisCmd() *cobra.Command {
+	var genesisCmd = &cobra.Command{
+		Use:   "genesis",
+		Short: "Creates and inspects genesis files (new, hash...)",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	genesisCmd.AddCommand(genesisNewCmd())
+	genesisCmd.AddCommand(genesisHashCmd())
+	return genesisCmd
+}
+
+func genesisNewCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "new",
+		Short: "Creates a new genesis file funding the given accounts",
+		Run: func(cmd *cobra.Command, args []string) {
+			out, _ := cmd.Flags().GetString(flagOut)
+
+			genesis, err := newGenesisFromCmd(cmd)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			err = genesis.Save(fs.ExpandPath(out))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			printGenesisHash(genesis)
+			fmt.Printf("Genesis saved to '%s'\n", out)
+		},
+	}
+
+	addNewGenesisFlags(cmd)
+	cmd.MarkFlagRequired(flagChainID)
+	cmd.MarkFlagRequired(flagAlloc)
+	cmd.Flags().String(flagOut, "", "file to save the genesis to")
+	cmd.MarkFlagRequired(flagOut)
+
+	return cmd
+}
+
+func genesisHashCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "hash",
+		Short: "Prints the hash of a genesis file, or of the genesis a data dir was initialised with",
+		Run: func(cmd *cobra.Command, args []string) {
+			genesisPath, _ := cmd.Flags().GetString(flagGenesis)
+			dataDir, _ := cmd.Flags().GetString(flagDataDir)
+
+			var genesis database.Genesis
+			var err error
+			switch {
+			case genesisPath != "":
+				genesis, err = database.LoadGenesis(fs.ExpandPath(genesisPath))
+			case dataDir != "":
+				genesis, err = database.LoadDataDirGenesis(fs.ExpandPath(dataDir))
+			default:
+				err = fmt.Errorf("either --%s or --%s is required", flagGenesis, flagDataDir)
+			}
+
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			printGenesisHash(genesis)
+		},
+	}
+
+	addGenesisFlag(cmd)
+	cmd.Flags().String(flagDataDir, "", "Absolute path to the node data dir whose genesis to hash")
+
+	return cmd
+}
+
+func addGenesisFlag(cmd *cobra.Command) {
+	cmd.Flags().String(flagGenesis, "", "path to the genesis file of the chain")
+}
+
+func addNewGenesisFlags(cmd *cobra.Command) {
+	cmd.Flags().String(flagChainID, "", "unique ID of the new chain")
+	cmd.Flags().StringSlice(flagAlloc, nil, "account funded by the genesis as account=balance, repeat for every account")
+	cmd.Flags().Uint64(flagCanonicalEncodingFork, database.DefaultCanonicalEncodingFork, "first block number using the canonical encoding")
+}
+
+func newGenesisFromCmd(cmd *cobra.Command) (database.Genesis, error) {
+	chainID, _ := cmd.Flags().GetString(flagChainID)
+	rawAllocs, _ := cmd.Flags().GetStringSlice(flagAlloc)
+
+	if chainID == "" {
+		return database.Genesis{}, fmt.Errorf("a new genesis requires a --%s", flagChainID)
+	}
+
+	if len(rawAllocs) == 0 {
+		return database.Genesis{}, fmt.Errorf("a new genesis requires at least one --%s", flagAlloc)
+	}
+
+	balances, err := parseAllocs(rawAllocs)
+	if err != nil {
+		return database.Genesis{}, err
+	}
+
+	genesis := database.NewGenesis(chainID, balances)
+	if cmd.Flags().Changed(flagCanonicalEncodingFork) {
+		fork, _ := cmd.Flags().GetUint64(flagCanonicalEncodingFork)
+		genesis.CanonicalEncodingFork = &fork
+	}
+
+	return genesis, nil
+}
+
+func parseAllocs(rawAllocs []string) (map[common.Address]uint, error) {
+	balances := make(map[common.Address]uint)
+	for _, rawAlloc := range rawAllocs {
+		parts := strings.SplitN(rawAlloc, "=", 2)
+		if len(parts) != 2 || !common.IsHexAddress(parts[0]) {
+			return nil, fmt.Errorf("'%s' is not a valid allocation, expected account=balance", rawAlloc)
+		}
+
+		balance, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a valid balance. %s", parts[1], err.Error())
+		}
+
+		account := database.NewAccount(parts[0])
+		if _, exists := balances[account]; exists {
+			return nil, fmt.Errorf("account '%s' is allocated more than once", account.Hex())
+		}
+
+		balances[account] = uint(balance)
+	}
+
+	return balances, nil
+}
+
+func printGenesisHash(genesis database.Genesis) {
+	hash, err := genesis.Hash()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Chain: %s\n", genesis.ChainID)
+	fmt.Printf("Genesis hash: %s\n", hash.Hex())
+}
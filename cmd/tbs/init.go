@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jTanG0506/go-blockchain/database"
+	"github.com/jTanG0506/go-blockchain/fs"
+	"github.com/jTanG0506/go-blockchain/node"
+	"github.com/spf13/cobra"
+)
+
+func initCmd() *cobra.Command {
+	var initCmd = &cobra.Command{
+		Use:   "init",
+		Short: "Initialises a data dir with a genesis file, or a new genesis funding the given accounts, and writes a node config file into it",
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+			genesisPath, _ := cmd.Flags().GetString(flagGenesis)
+
+			config, err := nodeConfigFromCmd(cmd)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			var genesis database.Genesis
+			if genesisPath != "" {
+				genesis, err = database.LoadGenesis(fs.ExpandPath(genesisPath))
+			} else {
+				genesis, err = newGenesisFromCmd(cmd)
+			}
+
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			if database.IsDataDirInitialised(dataDir) {
+				fmt.Printf("Data dir '%s' is already initialised\n", dataDir)
+				os.Exit(1)
+			}
+
+			err = database.InitDataDir(dataDir, genesis)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Initialised data dir '%s'\n", dataDir)
+			printGenesisHash(genesis)
+
+			configPath := filepath.Join(dataDir, nodeConfigFileName)
+			err = writeNodeConfig(configPath, config)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Wrote node config '%s', run the node with: tbs run --config=%s\n", configPath, configPath)
+		},
+	}
+
+	addDefaultRequiredFlags(initCmd)
+	addGenesisFlag(initCmd)
+	addNewGenesisFlags(initCmd)
+	initCmd.Flags().String(flagMiner, node.DefaultMiner, "miner account of the node to receive block rewards")
+	initCmd.Flags().String(flagIP, node.DefaultIP, "exposed IP of the node for communication with peers")
+	initCmd.Flags().Uint64(flagPort, node.DefaultHTTPPort, "exposed HTTP port of the node for communication with peers")
+	initCmd.Flags().StringSlice(flagBootstrap, nil, "bootstrap peer as account@host:port or host:port, repeat for every peer")
+
+	return initCmd
+}
+
+// nodeConfigFromCmd collects the `tbs run` settings given to `tbs init`,
+// keyed by the flag names the config file loader expects
+func nodeConfigFromCmd(cmd *cobra.Command) (map[string]interface{}, error) {
+	miner, _ := cmd.Flags().GetString(flagMiner)
+	ip, _ := cmd.Flags().GetString(flagIP)
+	port, _ := cmd.Flags().GetUint64(flagPort)
+	bootstraps, _ := cmd.Flags().GetStringSlice(flagBootstrap)
+	genesisPath, _ := cmd.Flags().GetString(flagGenesis)
+
+	for _, bootstrap := range bootstraps {
+		_, err := node.ParsePeerNode(bootstrap, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Absolute paths keep the config valid wherever the node is run from
+	dataDir, err := filepath.Abs(getDataDirFromCmd(cmd))
+	if err != nil {
+		return nil, err
+	}
+
+	config := map[string]interface{}{
+		flagDataDir: dataDir,
+		flagMiner:   miner,
+		flagIP:      ip,
+		flagPort:    port,
+	}
+
+	if len(bootstraps) > 0 {
+		config[flagBootstrap] = bootstraps
+	}
+
+	if genesisPath != "" {
+		config[flagGenesis], err = filepath.Abs(fs.ExpandPath(genesisPath))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
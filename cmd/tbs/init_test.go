@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInitWritesNodeConfig(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "tbs")
+	bootstrap := "0xf70D226203FDDa745C3B160D92Ee665A71191D6a@10.0.0.1:8080"
+
+	cmd := initCmd()
+	cmd.SetArgs([]string{
+		"--" + flagDataDir, dataDir,
+		"--" + flagChainID, "test-chain",
+		"--" + flagAlloc, "0xe5ED8C1829192380205b1E7BB5A3F44baf181d25=1000000",
+		"--" + flagMiner, "0xe5ED8C1829192380205b1E7BB5A3F44baf181d25",
+		"--" + flagIP, "10.0.0.3",
+		"--" + flagPort, "8082",
+		"--" + flagBootstrap, bootstrap,
+	})
+	err := cmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The node must start with the init settings from the config file alone
+	run := runCmd()
+	err = run.ParseFlags([]string{"--" + flagConfig, filepath.Join(dataDir, nodeConfigFileName)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = applyConfig(run)
+	if err != nil {
+		t.Fatalf("unable to load the config written by init. %s", err.Error())
+	}
+
+	for flag, expected := range map[string]string{
+		flagDataDir: dataDir,
+		flagMiner:   "0xe5ED8C1829192380205b1E7BB5A3F44baf181d25",
+		flagIP:      "10.0.0.3",
+		flagPort:    "8082",
+	} {
+		if value := run.Flags().Lookup(flag).Value.String(); value != expected {
+			t.Fatalf("expected config to set --%s to '%s', got '%s'", flag, expected, value)
+		}
+	}
+
+	bootstraps, _ := run.Flags().GetStringSlice(flagBootstrap)
+	if !reflect.DeepEqual(bootstraps, []string{bootstrap}) {
+		t.Fatalf("expected config to set --%s to %v, got %v", flagBootstrap, []string{bootstrap}, bootstraps)
+	}
+}
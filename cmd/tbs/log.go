@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/spf13/cobra"
+)
+
+const logFormatText = "text"
+const logFormatJSON = "json"
+
+func addLogFlags(cmd *cobra.Command) {
+	cmd.Flags().String(flagLogLevel, log.LvlInfo.String(), "minimum level of logged messages: trace, debug, info, warn, error or crit")
+	cmd.Flags().String(flagLogFormat, logFormatText, "format of logged messages: 'text' or 'json'")
+}
+
+// setupLogging sends the root logger, which discards everything by default,
+// to stderr with the level and format from the flags
+func setupLogging(cmd *cobra.Command) error {
+	level, _ := cmd.Flags().GetString(flagLogLevel)
+	format, _ := cmd.Flags().GetString(flagLogFormat)
+
+	lvl, err := log.LvlFromString(level)
+	if err != nil {
+		return err
+	}
+
+	var logFormat log.Format
+	switch format {
+	case logFormatText:
+		logFormat = log.TerminalFormat(false)
+	case logFormatJSON:
+		logFormat = log.JSONFormat()
+	default:
+		return fmt.Errorf("unknown log format '%s', expected '%s' or '%s'", format, logFormatText, logFormatJSON)
+	}
+
+	log.Root().SetHandler(log.LvlFilterHandler(lvl, log.StreamHandler(os.Stderr, logFormat)))
+	return nil
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/jTanG0506/go-blockchain/fs"
+	"github.com/jTanG0506/go-blockchain/node"
 	"github.com/spf13/cobra"
 )
 
@@ -16,6 +18,55 @@ const flagPort = "port"
 const flagBootstrapAcc = "bootstrap-account"
 const flagBootstrapIp = "bootstrap-ip"
 const flagBootstrapPort = "bootstrap-port"
+const flagMiningPolicy = "mining-policy"
+const flagMiningInterval = "mining-interval"
+const flagMaxBlockTXs = "max-block-txs"
+const flagMinBlockInterval = "min-block-interval"
+const flagMiningThreads = "mining-threads"
+const flagIndex = "index"
+const flagCount = "count"
+const flagHDPath = "hd-path"
+const flagImport = "import"
+const flagAddress = "address"
+const flagPrivateKeyFile = "private-key-file"
+const flagOut = "out"
+const flagIn = "in"
+const flagOwner = "owner"
+const flagThreshold = "threshold"
+const flagTo = "to"
+const flagValue = "value"
+const flagNonce = "nonce"
+const flagData = "data"
+const flagFrom = "from"
+const flagNode = "node"
+const flagYes = "yes"
+const flagMessage = "message"
+const flagSignature = "signature"
+const flagDev = "dev"
+const flagChainID = "chain-id"
+const flagAlloc = "alloc"
+const flagCanonicalEncodingFork = "canonical-encoding-fork"
+const flagGenesis = "genesis"
+const flagConfig = "config"
+const flagBootstrap = "bootstrap"
+const flagSeedFile = "seed-file"
+const flagMinPeers = "min-peers"
+const flagLogLevel = "log-level"
+const flagLogFormat = "log-format"
+const flagReadyMinPeers = "ready-min-peers"
+const flagReadyMaxBlockLag = "ready-max-block-lag"
+const flagSyncInterval = "sync-interval"
+const flagHTTPAddr = "http-addr"
+const flagToHeight = "to-height"
+const flagAtHeight = "at-height"
+const flagOutput = "output"
+const flagArchive = "archive"
+const flagPrune = "prune"
+const flagURL = "url"
+const flagSecret = "secret"
+const flagAccount = "account"
+const flagTX = "tx"
+const flagConfirmations = "confirmations"
 
 func main() {
 	var tbsCmd = &cobra.Command{
@@ -26,8 +77,15 @@ func main() {
 	}
 	tbsCmd.AddCommand(versionCmd)
 	tbsCmd.AddCommand(walletCmd())
+	tbsCmd.AddCommand(initCmd())
+	tbsCmd.AddCommand(genesisCmd())
 	tbsCmd.AddCommand(runCmd())
 	tbsCmd.AddCommand(balancesCmd())
+	tbsCmd.AddCommand(dbCmd())
+	tbsCmd.AddCommand(chainCmd())
+	tbsCmd.AddCommand(multisigCmd())
+	tbsCmd.AddCommand(txCmd())
+	tbsCmd.AddCommand(webhooksCmd())
 
 	err := tbsCmd.Execute()
 	if err != nil {
@@ -46,6 +104,15 @@ func addKeystoreFlag(cmd *cobra.Command) {
 	cmd.MarkFlagRequired(flagKeystoreFile)
 }
 
+func addNodeFlag(cmd *cobra.Command) {
+	cmd.Flags().String(flagNode, fmt.Sprintf("http://%s:%d", node.DefaultIP, node.DefaultHTTPPort), "HTTP address of the TBS node to talk to")
+}
+
+func getNodeURLFromCmd(cmd *cobra.Command) string {
+	nodeURL, _ := cmd.Flags().GetString(flagNode)
+	return strings.TrimSuffix(nodeURL, "/")
+}
+
 func getDataDirFromCmd(cmd *cobra.Command) string {
 	dataDir, _ := cmd.Flags().GetString(flagDataDir)
 	return fs.ExpandPath(dataDir)
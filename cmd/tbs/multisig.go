@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jTanG0506/go-blockchain/database"
+	"github.com/jTanG0506/go-blockchain/fs"
+	"github.com/jTanG0506/go-blockchain/wallet"
+	"github.com/spf13/cobra"
+)
+
+func multisigCmd() *cobra.Command {
+	var multisigCmd = &cobra.Command{
+		Use:   "multisig",
+		Short: "Manages M-of-N multisig accounts and their TXs (address, propose, sign, combine...)",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	multisigCmd.AddCommand(multisigAddressCmd())
+	multisigCmd.AddCommand(multisigProposeCmd())
+	multisigCmd.AddCommand(multisigSignCmd())
+	multisigCmd.AddCommand(multisigCombineCmd())
+	return multisigCmd
+}
+
+func multisigAddressCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "address",
+		Short: "Prints the address of the multisig account with the given owners and threshold",
+		Run: func(cmd *cobra.Command, args []string) {
+			multisig, err := getMultisigFromCmd(cmd)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Multisig account: %s\n", multisig.Address().Hex())
+		},
+	}
+
+	addMultisigFlags(cmd)
+	return cmd
+}
+
+func multisigProposeCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "propose",
+		Short: "Creates an unsigned TX proposal from a multisig account for its owners to sign",
+		Run: func(cmd *cobra.Command, args []string) {
+			to, _ := cmd.Flags().GetString(flagTo)
+			value, _ := cmd.Flags().GetUint(flagValue)
+			nonce, _ := cmd.Flags().GetUint(flagNonce)
+			data, _ := cmd.Flags().GetString(flagData)
+			out, _ := cmd.Flags().GetString(flagOut)
+
+			multisig, err := getMultisigFromCmd(cmd)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			tx := database.NewTx(multisig.Address(), database.NewAccount(to), value, nonce, data)
+			proposal, err := wallet.NewMultisigProposal(tx, multisig)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			err = proposal.Save(fs.ExpandPath(out))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Proposal written to %s, it needs %d owner signatures\n", out, multisig.Threshold)
+		},
+	}
+
+	addMultisigFlags(cmd)
+	cmd.Flags().String(flagTo, "", "recipient account of the TX")
+	cmd.Flags().Uint(flagValue, 0, "amount of TBS to send")
+	cmd.Flags().Uint(flagNonce, 0, "next nonce of the multisig account")
+	cmd.Flags().String(flagData, "", "optional TX data")
+	cmd.Flags().String(flagOut, "", "file to write the proposal to")
+	cmd.MarkFlagRequired(flagTo)
+	cmd.MarkFlagRequired(flagNonce)
+	cmd.MarkFlagRequired(flagOut)
+	return cmd
+}
+
+func multisigSignCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "sign",
+		Short: "Adds an owner's signature to a multisig TX proposal, can be run offline",
+		Run: func(cmd *cobra.Command, args []string) {
+			in, _ := cmd.Flags().GetString(flagIn)
+			ksFile, _ := cmd.Flags().GetString(flagKeystoreFile)
+
+			proposal, err := wallet.LoadMultisigProposal(fs.ExpandPath(in))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			password := getPassphrase("Please enter a password to decrypt the wallet:", false)
+			key, err := wallet.DecryptKeystoreFile(fs.ExpandPath(ksFile), password)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			err = proposal.Sign(key.PrivateKey)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			err = proposal.Save(fs.ExpandPath(in))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Signed by %s, %d of %d required signatures collected\n", key.Address.Hex(), len(proposal.Sigs), proposal.Multisig.Threshold)
+		},
+	}
+
+	addKeystoreFlag(cmd)
+	addInFlag(cmd)
+	return cmd
+}
+
+func multisigCombineCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "combine",
+		Short: "Combines the owner signatures of a proposal into a signed TX ready to be sent to a node",
+		Run: func(cmd *cobra.Command, args []string) {
+			in, _ := cmd.Flags().GetString(flagIn)
+			out, _ := cmd.Flags().GetString(flagOut)
+
+			proposal, err := wallet.LoadMultisigProposal(fs.ExpandPath(in))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			signedTx, err := proposal.Combine()
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			err = wallet.NewSignedTxFile(signedTx).Save(fs.ExpandPath(out))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Signed TX written to %s, send it to a node with 'tbs tx broadcast'\n", out)
+		},
+	}
+
+	addInFlag(cmd)
+	cmd.Flags().String(flagOut, "", "file to write the signed TX to")
+	cmd.MarkFlagRequired(flagOut)
+	return cmd
+}
+
+func addMultisigFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice(flagOwner, nil, "owner account of the multisig, repeat for every owner")
+	cmd.Flags().Uint(flagThreshold, 0, "number of owner signatures required to authorise a TX")
+	cmd.MarkFlagRequired(flagOwner)
+	cmd.MarkFlagRequired(flagThreshold)
+}
+
+func addInFlag(cmd *cobra.Command) {
+	cmd.Flags().String(flagIn, "", "file to read the proposal from")
+	cmd.MarkFlagRequired(flagIn)
+}
+
+func getMultisigFromCmd(cmd *cobra.Command) (database.Multisig, error) {
+	rawOwners, _ := cmd.Flags().GetStringSlice(flagOwner)
+	threshold, _ := cmd.Flags().GetUint(flagThreshold)
+
+	owners := make([]common.Address, len(rawOwners))
+	for i, owner := range rawOwners {
+		if !common.IsHexAddress(owner) {
+			return database.Multisig{}, fmt.Errorf("'%s' is not a valid owner account", owner)
+		}
+
+		owners[i] = database.NewAccount(owner)
+	}
+
+	return database.NewMultisig(threshold, owners)
+}
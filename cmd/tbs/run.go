@@ -4,8 +4,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/jTanG0506/go-blockchain/database"
+	"github.com/jTanG0506/go-blockchain/fs"
 	"github.com/jTanG0506/go-blockchain/node"
 	"github.com/spf13/cobra"
 )
@@ -14,6 +18,14 @@ func runCmd() *cobra.Command {
 	var runCmd = &cobra.Command{
 		Use:   "run",
 		Short: "Launches the TBS node and its HTTP API",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			err := applyConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			return setupLogging(cmd)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			miner, _ := cmd.Flags().GetString(flagMiner)
 			ip, _ := cmd.Flags().GetString(flagIP)
@@ -21,19 +33,105 @@ func runCmd() *cobra.Command {
 			bootstrapIp, _ := cmd.Flags().GetString(flagBootstrapIp)
 			bootstrapPort, _ := cmd.Flags().GetUint64(flagBootstrapPort)
 			bootstrapAcc, _ := cmd.Flags().GetString(flagBootstrapAcc)
+			rawBootstraps, _ := cmd.Flags().GetStringSlice(flagBootstrap)
+			seedFile, _ := cmd.Flags().GetString(flagSeedFile)
+			minPeers, _ := cmd.Flags().GetInt(flagMinPeers)
+			miningPolicy, _ := cmd.Flags().GetString(flagMiningPolicy)
+			miningInterval, _ := cmd.Flags().GetDuration(flagMiningInterval)
+			maxBlockTXs, _ := cmd.Flags().GetInt(flagMaxBlockTXs)
+			minBlockInterval, _ := cmd.Flags().GetDuration(flagMinBlockInterval)
+			miningThreads, _ := cmd.Flags().GetInt(flagMiningThreads)
+			dev, _ := cmd.Flags().GetBool(flagDev)
+			genesisPath, _ := cmd.Flags().GetString(flagGenesis)
+			syncInterval, _ := cmd.Flags().GetDuration(flagSyncInterval)
+			httpAddr, _ := cmd.Flags().GetString(flagHTTPAddr)
+			archive, _ := cmd.Flags().GetBool(flagArchive)
+			prune, _ := cmd.Flags().GetUint64(flagPrune)
+			readyMinPeers, _ := cmd.Flags().GetInt(flagReadyMinPeers)
+			readyMaxBlockLag, _ := cmd.Flags().GetUint64(flagReadyMaxBlockLag)
+
+			policy, err := node.ParseMiningPolicy(miningPolicy)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			if genesisPath != "" {
+				genesis, err := database.LoadGenesis(fs.ExpandPath(genesisPath))
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+
+				err = database.InitDataDir(getDataDirFromCmd(cmd), genesis)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			}
 
-			fmt.Println("Launching TBS node and its HTTP API...")
+			if dev {
+				err := database.InitDevDataDir(getDataDirFromCmd(cmd))
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
 
-			bootstrap := node.NewPeerNode(
+				if bootstrapIp == "" && len(rawBootstraps) == 0 && seedFile == "" {
+					bootstrapIp = node.DevBootstrapIp
+					bootstrapPort = node.DevBootstrapPort
+					bootstrapAcc = node.DevBootstrapAcc
+				}
+			}
+
+			log.Info("Launching TBS node and its HTTP API")
+
+			bootstraps := []node.PeerNode{node.NewPeerNode(
 				bootstrapIp,
 				bootstrapPort,
 				true,
 				database.NewAccount(bootstrapAcc),
 				false,
-			)
+			)}
+
+			for _, rawBootstrap := range rawBootstraps {
+				peer, err := node.ParsePeerNode(rawBootstrap, true)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+
+				bootstraps = append(bootstraps, peer)
+			}
+
+			n := node.NewNode(getDataDirFromCmd(cmd), ip, port, database.NewAccount(miner), bootstraps...)
+			if seedFile != "" {
+				n.SetSeedFile(fs.ExpandPath(seedFile))
+			}
+			n.SetMinPeers(minPeers)
+			n.SetSyncInterval(syncInterval)
+			n.SetHealthConfig(node.HealthConfig{
+				ReadyMinPeers:    readyMinPeers,
+				ReadyMaxBlockLag: readyMaxBlockLag,
+			})
+			if httpAddr != "" {
+				n.SetHTTPAddr(httpAddr)
+			}
+			n.SetArchive(archive)
+			n.SetPruning(prune)
+
+			n.SetMiningConfig(node.MiningConfig{
+				Policy:           policy,
+				Interval:         miningInterval,
+				MaxTXsPerBlock:   maxBlockTXs,
+				MinBlockInterval: minBlockInterval,
+				Threads:          miningThreads,
+			})
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
 
-			n := node.NewNode(getDataDirFromCmd(cmd), ip, port, database.NewAccount(miner), bootstrap)
-			err := n.Run(context.Background())
+			err = n.Run(ctx)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
@@ -42,12 +140,30 @@ func runCmd() *cobra.Command {
 	}
 
 	addDefaultRequiredFlags(runCmd)
+	addConfigFlag(runCmd)
+	addLogFlags(runCmd)
 	runCmd.Flags().String(flagMiner, node.DefaultMiner, "miner account of this node to receive block rewards")
 	runCmd.Flags().String(flagIP, node.DefaultIP, "exposed IP for communication with peers")
 	runCmd.Flags().Uint64(flagPort, node.DefaultHTTPPort, "exposed HTTP port for communication with peers")
-	runCmd.Flags().String(flagBootstrapIp, node.DefaultBootstrapIp, "default bootstrap server to interconnect peers")
-	runCmd.Flags().Uint64(flagBootstrapPort, node.DefaultBootstrapPort, "default bootstrap server port to interconnect peers")
-	runCmd.Flags().String(flagBootstrapAcc, node.DefaultBootstrapAcc, "default bootstrap account to interconnect peers")
+	runCmd.Flags().String(flagBootstrapIp, "", "bootstrap server to interconnect peers")
+	runCmd.Flags().Uint64(flagBootstrapPort, 0, "bootstrap server port to interconnect peers")
+	runCmd.Flags().String(flagBootstrapAcc, "", "bootstrap account to interconnect peers")
+	runCmd.Flags().StringSlice(flagBootstrap, nil, "bootstrap peer as account@host:port or host:port, repeat for every peer")
+	runCmd.Flags().String(flagSeedFile, "", "file of host:port lines to pick peers from, DNS names resolve to every address they point to")
+	runCmd.Flags().Int(flagMinPeers, node.DefaultMinPeers, "re-seed from the bootstrap peers and seed file when knowing fewer peers")
+	runCmd.Flags().String(flagHTTPAddr, "", "address the HTTP API binds to (default \":<port>\")")
+	runCmd.Flags().Bool(flagArchive, false, "keep the state diff of every block to serve historical balances without replaying the chain")
+	runCmd.Flags().Uint64(flagPrune, 0, "keep the TXs of only the last N blocks once a state snapshot covers the older ones, 0 keeps every block")
+	runCmd.Flags().Duration(flagSyncInterval, node.DefaultSyncInterval, "how often the node syncs blocks, peers and TXs with its peers")
+	runCmd.Flags().Int(flagReadyMinPeers, node.DefaultReadyMinPeers, "known peers required for /readyz to report the node ready")
+	runCmd.Flags().Uint64(flagReadyMaxBlockLag, node.DefaultReadyMaxBlockLag, "blocks the node may be behind its best peer for /readyz to report it ready")
+	runCmd.Flags().String(flagGenesis, "", "genesis file of the chain, the node refuses to start if the data dir was initialised with another genesis")
+	runCmd.Flags().Bool(flagDev, false, "join the local demo network, initialising the data dir with the dev genesis and bootstrap node")
+	runCmd.Flags().String(flagMiningPolicy, string(node.DefaultMiningPolicy), "when to mine blocks: 'txs' only with pending TXs, 'always' back to back, 'schedule' once every mining interval")
+	runCmd.Flags().Duration(flagMiningInterval, node.DefaultMiningConfig().Interval, "how often the node considers mining a new block")
+	runCmd.Flags().Int(flagMaxBlockTXs, node.DefaultMaxTXsPerBlock, "maximum number of TXs in a mined block, 0 for unlimited")
+	runCmd.Flags().Duration(flagMinBlockInterval, node.DefaultMinBlockInterval, "minimum time between the latest block and the next mined block")
+	runCmd.Flags().Int(flagMiningThreads, node.DefaultMiningThreads, "number of proof-of-work mining threads, 0 for one per CPU")
 
 	return runCmd
 }
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jTanG0506/go-blockchain/database"
+	"github.com/jTanG0506/go-blockchain/fs"
+	"github.com/jTanG0506/go-blockchain/node"
+	"github.com/jTanG0506/go-blockchain/wallet"
+	"github.com/spf13/cobra"
+)
+
+func txCmd() *cobra.Command {
+	var txCmd = &cobra.Command{
+		Use:   "tx",
+		Short: "Builds, signs offline and broadcasts TXs (build, sign, broadcast...)",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	txCmd.AddCommand(txBuildCmd())
+	txCmd.AddCommand(txSignCmd())
+	txCmd.AddCommand(txBroadcastCmd())
+	return txCmd
+}
+
+func txBuildCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "build",
+		Short: "Builds an unsigned TX file, asking a node for the sender's next nonce",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			to, _ := cmd.Flags().GetString(flagTo)
+			value, _ := cmd.Flags().GetUint(flagValue)
+			data, _ := cmd.Flags().GetString(flagData)
+			out, _ := cmd.Flags().GetString(flagOut)
+
+			sender := database.NewAccount(from)
+			nonce, err := node.QueryNextNonce(getNodeURLFromCmd(cmd), sender)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			tx := database.NewTx(sender, database.NewAccount(to), value, nonce, data)
+			err = wallet.NewUnsignedTxFile(tx).Save(fs.ExpandPath(out))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			printTxSummary(tx)
+			fmt.Printf("Unsigned TX written to %s\n", out)
+		},
+	}
+
+	addNodeFlag(cmd)
+	cmd.Flags().String(flagFrom, "", "sender account of the TX")
+	cmd.Flags().String(flagTo, "", "recipient account of the TX")
+	cmd.Flags().Uint(flagValue, 0, "amount of TBS to send")
+	cmd.Flags().String(flagData, "", "optional TX data")
+	cmd.Flags().String(flagOut, "", "file to write the unsigned TX to")
+	cmd.MarkFlagRequired(flagFrom)
+	cmd.MarkFlagRequired(flagTo)
+	cmd.MarkFlagRequired(flagOut)
+	return cmd
+}
+
+func txSignCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "sign",
+		Short: "Signs an unsigned TX file with a keystore file, meant to be run on an offline machine",
+		Run: func(cmd *cobra.Command, args []string) {
+			in, _ := cmd.Flags().GetString(flagIn)
+			out, _ := cmd.Flags().GetString(flagOut)
+			ksFile, _ := cmd.Flags().GetString(flagKeystoreFile)
+			yes, _ := cmd.Flags().GetBool(flagYes)
+
+			txFile, err := wallet.LoadTxFile(fs.ExpandPath(in))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			if txFile.Type != wallet.TxFileTypeUnsigned {
+				fmt.Printf("%s doesn't contain an unsigned TX\n", in)
+				os.Exit(1)
+			}
+
+			printTxSummary(*txFile.Tx)
+			if !yes && !confirm("Sign this TX?") {
+				fmt.Println("TX not signed")
+				os.Exit(1)
+			}
+
+			password := getPassphrase("Please enter a password to decrypt the wallet:", false)
+			key, err := wallet.DecryptKeystoreFile(fs.ExpandPath(ksFile), password)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			if key.Address != txFile.Tx.From {
+				fmt.Printf("keystore account %s isn't the TX sender %s\n", key.Address.Hex(), txFile.Tx.From.Hex())
+				os.Exit(1)
+			}
+
+			signedTx, err := wallet.SignTx(*txFile.Tx, key.PrivateKey)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			err = wallet.NewSignedTxFile(signedTx).Save(fs.ExpandPath(out))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Signed TX written to %s\n", out)
+		},
+	}
+
+	addKeystoreFlag(cmd)
+	addInFlag(cmd)
+	cmd.Flags().String(flagOut, "", "file to write the signed TX to")
+	cmd.Flags().Bool(flagYes, false, "sign without asking for confirmation")
+	cmd.MarkFlagRequired(flagOut)
+	return cmd
+}
+
+func txBroadcastCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "broadcast",
+		Short: "Sends a signed TX file to a node",
+		Run: func(cmd *cobra.Command, args []string) {
+			in, _ := cmd.Flags().GetString(flagIn)
+
+			txFile, err := wallet.LoadTxFile(fs.ExpandPath(in))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			if txFile.Type != wallet.TxFileTypeSigned {
+				fmt.Printf("%s doesn't contain a signed TX\n", in)
+				os.Exit(1)
+			}
+
+			err = node.BroadcastTX(getNodeURLFromCmd(cmd), *txFile.SignedTx)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			txHash, _ := txFile.SignedTx.Hash()
+			fmt.Printf("TX %s broadcast\n", txHash.Hex())
+		},
+	}
+
+	addNodeFlag(cmd)
+	addInFlag(cmd)
+	return cmd
+}
+
+func printTxSummary(tx database.Tx) {
+	txHash, _ := tx.Hash()
+
+	fmt.Println("TX Summary")
+	fmt.Println("----------------")
+	fmt.Printf("From:  %s\n", tx.From.Hex())
+	fmt.Printf("To:    %s\n", tx.To.Hex())
+	fmt.Printf("Value: %d TBS\n", tx.Value)
+	fmt.Printf("Fee:   %d TBS\n", database.TxGasFee)
+	fmt.Printf("Total: %d TBS\n", tx.Value+database.TxGasFee)
+	fmt.Printf("Nonce: %d\n", tx.Nonce)
+	fmt.Printf("Data:  %q\n", tx.Data)
+	fmt.Printf("Time:  %s\n", time.Unix(int64(tx.Time), 0).UTC().Format(time.RFC3339))
+	fmt.Printf("Hash:  %s\n", txHash.Hex())
+	fmt.Println("")
+}
+
+func confirm(prompt string) bool {
+	fmt.Printf("%s [y/N]: ", prompt)
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
@@ -5,9 +5,11 @@ import (
 	"io/ioutil"
 	"os"
 
-	"github.com/davecgh/go-spew/spew"
-	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jTanG0506/go-blockchain/database"
+	"github.com/jTanG0506/go-blockchain/fs"
 	"github.com/jTanG0506/go-blockchain/wallet"
 	"github.com/spf13/cobra"
 )
@@ -25,6 +27,15 @@ func walletCmd() *cobra.Command {
 
 	walletCmd.AddCommand(walletNewAccountCmd())
 	walletCmd.AddCommand(walletPrintPrivateKeyCmd())
+	walletCmd.AddCommand(walletAddressCmd())
+	walletCmd.AddCommand(walletListCmd())
+	walletCmd.AddCommand(walletImportCmd())
+	walletCmd.AddCommand(walletExportCmd())
+	walletCmd.AddCommand(walletChangePasswordCmd())
+	walletCmd.AddCommand(walletSignMessageCmd())
+	walletCmd.AddCommand(walletVerifyMessageCmd())
+	walletCmd.AddCommand(walletNewMnemonicCmd())
+	walletCmd.AddCommand(walletDeriveCmd())
 	return walletCmd
 }
 
@@ -58,19 +69,39 @@ func walletPrintPrivateKeyCmd() *cobra.Command {
 			ksFile, _ := cmd.Flags().GetString(flagKeystoreFile)
 			password := getPassphrase("Please enter a password to decrypt the wallet:", false)
 
-			keyJson, err := ioutil.ReadFile(ksFile)
+			key, err := wallet.DecryptKeystoreFile(ksFile, password)
 			if err != nil {
 				fmt.Println(err.Error())
 				os.Exit(1)
 			}
 
-			key, err := keystore.DecryptKey(keyJson, password)
+			fmt.Println("WARNING: anyone who sees the private key below controls the account")
+			fmt.Printf("Address: %s\n", key.Address.Hex())
+			fmt.Printf("Public key: %s\n", hexutil.Encode(crypto.FromECDSAPub(&key.PrivateKey.PublicKey)))
+			fmt.Printf("Private key: %s\n", hexutil.Encode(crypto.FromECDSA(key.PrivateKey)))
+		},
+	}
+
+	addKeystoreFlag(cmd)
+	return cmd
+}
+
+func walletAddressCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "address",
+		Short: "Unlocks keystore file and prints its address and public key, without the private key",
+		Run: func(cmd *cobra.Command, args []string) {
+			ksFile, _ := cmd.Flags().GetString(flagKeystoreFile)
+			password := getPassphrase("Please enter a password to decrypt the wallet:", false)
+
+			key, err := wallet.DecryptKeystoreFile(ksFile, password)
 			if err != nil {
 				fmt.Println(err.Error())
 				os.Exit(1)
 			}
 
-			spew.Dump(key)
+			fmt.Printf("Address: %s\n", key.Address.Hex())
+			fmt.Printf("Public key: %s\n", hexutil.Encode(crypto.FromECDSAPub(&key.PrivateKey.PublicKey)))
 		},
 	}
 
@@ -78,6 +109,276 @@ func walletPrintPrivateKeyCmd() *cobra.Command {
 	return cmd
 }
 
+func walletListCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists the accounts in the node's keystore",
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, acc := range wallet.ListKeystoreAccounts(getDataDirFromCmd(cmd)) {
+				fmt.Printf("%s: %s\n", acc.Address.Hex(), acc.URL.Path)
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	return cmd
+}
+
+func walletImportCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "import",
+		Short: "Imports a hex encoded private key from a file into the node's keystore",
+		Run: func(cmd *cobra.Command, args []string) {
+			pkFile, _ := cmd.Flags().GetString(flagPrivateKeyFile)
+			password := getPassphrase("Enter a password to encrypt the imported account:", true)
+
+			acc, err := wallet.ImportPrivateKeyFile(getDataDirFromCmd(cmd), fs.ExpandPath(pkFile), password)
+			if err == wallet.ErrAccountAlreadyExists {
+				fmt.Printf("Account %s is already in the keystore and keeps its current password, run 'tbs wallet change-password' to change it\n", acc.Hex())
+				os.Exit(1)
+			}
+
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Account imported: %s\n", acc.Hex())
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagPrivateKeyFile, "", "Absolute path to a file containing a hex encoded private key")
+	cmd.MarkFlagRequired(flagPrivateKeyFile)
+	return cmd
+}
+
+func walletExportCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "export",
+		Short: "Exports an account from the node's keystore as keystore JSON encrypted with a new password",
+		Run: func(cmd *cobra.Command, args []string) {
+			address, _ := cmd.Flags().GetString(flagAddress)
+			out, _ := cmd.Flags().GetString(flagOut)
+
+			password := getPassphrase("Please enter a password to decrypt the wallet:", false)
+			newPassword := getPassphrase("Enter a password to encrypt the exported wallet:", true)
+
+			keyJson, err := wallet.ExportKeystoreAccount(getDataDirFromCmd(cmd), database.NewAccount(address), password, newPassword)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			if out == "" {
+				fmt.Println(string(keyJson))
+				return
+			}
+
+			err = ioutil.WriteFile(fs.ExpandPath(out), keyJson, 0600)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Account %s exported to %s\n", address, out)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	addAddressFlag(cmd)
+	cmd.Flags().String(flagOut, "", "file to write the exported keystore JSON to, printed when empty")
+	return cmd
+}
+
+func walletChangePasswordCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "change-password",
+		Short: "Re-encrypts an account in the node's keystore with a new password",
+		Run: func(cmd *cobra.Command, args []string) {
+			address, _ := cmd.Flags().GetString(flagAddress)
+
+			password := getPassphrase("Please enter the current password of the wallet:", false)
+			newPassword := getPassphrase("Enter the new password of the wallet:", true)
+
+			err := wallet.ChangeKeystorePassword(getDataDirFromCmd(cmd), database.NewAccount(address), password, newPassword)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Password of account %s changed\n", address)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	addAddressFlag(cmd)
+	return cmd
+}
+
+func walletSignMessageCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "sign-message",
+		Short: "Signs an arbitrary message with a keystore file to prove control of its address",
+		Run: func(cmd *cobra.Command, args []string) {
+			ksFile, _ := cmd.Flags().GetString(flagKeystoreFile)
+			message, _ := cmd.Flags().GetString(flagMessage)
+			password := getPassphrase("Please enter a password to decrypt the wallet:", false)
+
+			key, err := wallet.DecryptKeystoreFile(ksFile, password)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+
+			sig, err := wallet.SignMessage([]byte(message), key.PrivateKey)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+
+			fmt.Printf("Address: %s\n", key.Address.Hex())
+			fmt.Printf("Signature: %s\n", hexutil.Encode(sig))
+		},
+	}
+
+	addKeystoreFlag(cmd)
+	addMessageFlag(cmd)
+	return cmd
+}
+
+func walletVerifyMessageCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "verify-message",
+		Short: "Verifies that a message was signed by the given address",
+		Run: func(cmd *cobra.Command, args []string) {
+			address, _ := cmd.Flags().GetString(flagAddress)
+			message, _ := cmd.Flags().GetString(flagMessage)
+			rawSig, _ := cmd.Flags().GetString(flagSignature)
+
+			sig, err := hexutil.Decode(rawSig)
+			if err != nil {
+				fmt.Printf("invalid signature. %s\n", err.Error())
+				os.Exit(1)
+			}
+
+			signer, err := wallet.VerifyMessage([]byte(message), sig)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+
+			if signer != database.NewAccount(address) {
+				fmt.Printf("Invalid: message was signed by %s, not %s\n", signer.Hex(), address)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Valid: message was signed by %s\n", signer.Hex())
+		},
+	}
+
+	addAddressFlag(cmd)
+	addMessageFlag(cmd)
+	cmd.Flags().String(flagSignature, "", "hex encoded signature of the message")
+	cmd.MarkFlagRequired(flagSignature)
+	return cmd
+}
+
+func addMessageFlag(cmd *cobra.Command) {
+	cmd.Flags().String(flagMessage, "", "message to sign or verify")
+	cmd.MarkFlagRequired(flagMessage)
+}
+
+func addAddressFlag(cmd *cobra.Command) {
+	cmd.Flags().String(flagAddress, "", "address of the keystore account")
+	cmd.MarkFlagRequired(flagAddress)
+}
+
+func walletNewMnemonicCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "new-mnemonic",
+		Short: "Generates a new BIP-39 mnemonic to derive HD wallet accounts from",
+		Run: func(cmd *cobra.Command, args []string) {
+			mnemonic, err := wallet.NewMnemonic()
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			key, err := wallet.DeriveAccountKey(mnemonic, "", wallet.DefaultHDBasePath, 0)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Println("Write down the mnemonic and keep it safe, anyone who has it controls every derived account:")
+			fmt.Println("")
+			fmt.Println(mnemonic)
+			fmt.Println("")
+			fmt.Printf("First account (%s/0): %s\n", wallet.DefaultHDBasePath, key.Address.Hex())
+		},
+	}
+
+	return cmd
+}
+
+func walletDeriveCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "derive",
+		Short: "Derives accounts from a BIP-39 mnemonic and optionally imports them into the keystore",
+		Run: func(cmd *cobra.Command, args []string) {
+			index, _ := cmd.Flags().GetUint32(flagIndex)
+			count, _ := cmd.Flags().GetUint32(flagCount)
+			hdPath, _ := cmd.Flags().GetString(flagHDPath)
+			shouldImport, _ := cmd.Flags().GetBool(flagImport)
+			dataDir := getDataDirFromCmd(cmd)
+
+			if shouldImport && dataDir == "" {
+				fmt.Printf("--%s is required to import derived accounts\n", flagDataDir)
+				os.Exit(1)
+			}
+
+			mnemonic := getPassphrase("Enter the mnemonic:", false)
+			passphrase := getPassphrase("Enter the mnemonic passphrase, if any:", false)
+
+			password := ""
+			if shouldImport {
+				password = getPassphrase("Enter a password to encrypt the imported accounts:", true)
+			}
+
+			for i := index; i < index+count; i++ {
+				key, err := wallet.DeriveAccountKey(mnemonic, passphrase, hdPath, i)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+
+				if shouldImport {
+					_, err = wallet.ImportKey(dataDir, key.PrivateKey, password)
+					if err == wallet.ErrAccountAlreadyExists {
+						fmt.Printf("%s/%d: %s is already in the keystore and keeps its current password\n", hdPath, i, key.Address.Hex())
+						continue
+					}
+
+					if err != nil {
+						fmt.Println(err)
+						os.Exit(1)
+					}
+				}
+
+				fmt.Printf("%s/%d: %s\n", hdPath, i, key.Address.Hex())
+			}
+		},
+	}
+
+	cmd.Flags().String(flagDataDir, "", "Absolute path to the node data dir whose keystore derived accounts are imported into")
+	cmd.Flags().Uint32(flagIndex, 0, "index of the first account to derive")
+	cmd.Flags().Uint32(flagCount, 1, "number of consecutive accounts to derive")
+	cmd.Flags().String(flagHDPath, wallet.DefaultHDBasePath, "BIP-44 base path, the account index is appended to it")
+	cmd.Flags().Bool(flagImport, false, "import the derived accounts into the keystore of --datadir")
+	return cmd
+}
+
 func getPassphrase(prompt string, confirm bool) string {
 	return utils.GetPassPhrase(prompt, confirm)
 }
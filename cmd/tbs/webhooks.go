@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jTanG0506/go-blockchain/node"
+	"github.com/spf13/cobra"
+)
+
+func webhooksCmd() *cobra.Command {
+	var webhooksCmd = &cobra.Command{
+		Use:   "webhooks",
+		Short: "Manages the webhooks of a running node (add, list, remove...)",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	webhooksCmd.AddCommand(webhooksAddCmd())
+	webhooksCmd.AddCommand(webhooksListCmd())
+	webhooksCmd.AddCommand(webhooksRemoveCmd())
+	return webhooksCmd
+}
+
+func webhooksAddCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "add",
+		Short: "Registers a webhook called when accounts send or receive funds, or when a TX is confirmed",
+		Run: func(cmd *cobra.Command, args []string) {
+			hookURL, _ := cmd.Flags().GetString(flagURL)
+			secret, _ := cmd.Flags().GetString(flagSecret)
+			accounts, _ := cmd.Flags().GetStringSlice(flagAccount)
+			tx, _ := cmd.Flags().GetString(flagTX)
+
+			// The default only applies to a watched TX
+			confirmations := uint64(0)
+			if tx != "" || cmd.Flags().Changed(flagConfirmations) {
+				confirmations, _ = cmd.Flags().GetUint64(flagConfirmations)
+			}
+
+			hook, err := node.RegisterWebhook(getNodeURLFromCmd(cmd), node.AddWebhookReq{
+				URL:           hookURL,
+				Secret:        secret,
+				Accounts:      accounts,
+				TX:            tx,
+				Confirmations: confirmations,
+			})
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			printWebhook(hook)
+			fmt.Printf("Secret: %s\n", hook.Secret)
+			fmt.Printf("Verify deliveries against their %s header with it, it isn't shown again\n", node.WebhookSignatureHeader)
+		},
+	}
+
+	addNodeFlag(cmd)
+	cmd.Flags().String(flagURL, "", "URL the deliveries are POSTed to")
+	cmd.Flags().String(flagSecret, "", "secret the deliveries are signed with, generated if empty")
+	cmd.Flags().StringSlice(flagAccount, nil, "account whose funds sent or received trigger the webhook, repeat for every account")
+	cmd.Flags().String(flagTX, "", "TX whose confirmation triggers the webhook")
+	cmd.Flags().Uint64(flagConfirmations, 1, "confirmations the TX must reach to trigger the webhook")
+	cmd.MarkFlagRequired(flagURL)
+	return cmd
+}
+
+func webhooksListCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists the webhooks registered on the node",
+		Run: func(cmd *cobra.Command, args []string) {
+			hooks, err := node.ListWebhooks(getNodeURLFromCmd(cmd))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			for i, hook := range hooks {
+				if i > 0 {
+					fmt.Println("")
+				}
+				printWebhook(hook)
+			}
+		},
+	}
+
+	addNodeFlag(cmd)
+	return cmd
+}
+
+func webhooksRemoveCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "remove <id>",
+		Short: "Removes a webhook from the node",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			hook, err := node.RemoveWebhook(getNodeURLFromCmd(cmd), args[0])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Removed webhook %s to %s\n", hook.ID, hook.URL)
+		},
+	}
+
+	addNodeFlag(cmd)
+	return cmd
+}
+
+func printWebhook(hook node.Webhook) {
+	fmt.Printf("Webhook %s\n", hook.ID)
+	fmt.Printf("  url:      %s\n", hook.URL)
+
+	if len(hook.Accounts) > 0 {
+		accounts := make([]string, len(hook.Accounts))
+		for i, account := range hook.Accounts {
+			accounts[i] = account.Hex()
+		}
+		fmt.Printf("  accounts: %s\n", strings.Join(accounts, ", "))
+	}
+
+	if hook.TX == nil {
+		return
+	}
+
+	status := "pending"
+	if hook.Confirmed {
+		status = "confirmed"
+	} else if hook.IncludedIn != nil {
+		status = fmt.Sprintf("included in block %d", *hook.IncludedIn)
+	}
+	fmt.Printf("  tx:       %s (%s, confirmations required: %d)\n", hook.TX.Hex(), status, hook.Confirmations)
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// StateDiff is what a block changed in the state: the balance and nonce, after
+// the block, of every account it touched
+type StateDiff struct {
+	Number   uint64                          `json:"number"`
+	Hash     Hash                            `json:"hash"`
+	Accounts map[common.Address]AccountState `json:"accounts"`
+}
+
+// AccountState is the balance and nonce of an account as of a block
+type AccountState struct {
+	Number  uint64 `json:"block_number"`
+	Hash    Hash   `json:"block_hash"`
+	Balance uint   `json:"balance"`
+	Nonce   uint   `json:"nonce"`
+}
+
+type storedDiff struct {
+	hash Hash
+	end  int64
+}
+
+// archive keeps the state diff of every block in the archive DB and indexes
+// them by account, so the state of an account at any height is looked up
+// without replaying blocks
+type archive struct {
+	mu       sync.RWMutex
+	file     *os.File
+	genesis  map[common.Address]uint
+	hashes   []Hash
+	accounts map[common.Address][]AccountState
+
+	// stored are the diffs found in the archive DB while loading, only the
+	// ones missing or no longer matching the chain are rewritten
+	stored    []storedDiff
+	rewriting bool
+}
+
+func openArchive(dataDir string, gen Genesis) (*archive, error) {
+	f, err := os.OpenFile(getArchiveDbFilePath(dataDir), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &archive{file: f, genesis: gen.Balances, accounts: make(map[common.Address][]AccountState)}
+
+	reader := bufio.NewReader(f)
+	end := int64(0)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			f.Close()
+			return nil, err
+		}
+
+		// A partially written or corrupt diff is dropped along with those
+		// after it, replaying the chain writes them again
+		if err == io.EOF {
+			break
+		}
+
+		var diff StateDiff
+		if json.Unmarshal(bytes.TrimSpace(line), &diff) != nil {
+			break
+		}
+
+		end += int64(len(line))
+		a.stored = append(a.stored, storedDiff{diff.Hash, end})
+	}
+
+	err = f.Truncate(end)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// replayed indexes the diff of a block replayed while loading the state,
+// writing it to the archive DB unless it's already there
+func (a *archive) replayed(diff StateDiff) error {
+	i := len(a.hashes)
+	if !a.rewriting && i < len(a.stored) && a.stored[i].hash == diff.Hash {
+		a.index(diff)
+		return nil
+	}
+
+	if !a.rewriting {
+		a.rewriting = true
+
+		offset := int64(0)
+		if i > 0 {
+			offset = a.stored[i-1].end
+		}
+
+		err := a.file.Truncate(offset)
+		if err != nil {
+			return err
+		}
+	}
+
+	a.index(diff)
+	return a.write(diff)
+}
+
+// loaded ends the loading of the state, flushing the diffs it rewrote
+func (a *archive) loaded() error {
+	if !a.rewriting && len(a.stored) > len(a.hashes) {
+		offset := int64(0)
+		if len(a.hashes) > 0 {
+			offset = a.stored[len(a.hashes)-1].end
+		}
+
+		err := a.file.Truncate(offset)
+		if err != nil {
+			return err
+		}
+	}
+
+	a.stored = nil
+	a.rewriting = false
+
+	return a.file.Sync()
+}
+
+// append indexes and persists the diff of a block added to the chain
+func (a *archive) append(diff StateDiff) error {
+	a.mu.Lock()
+	a.index(diff)
+	a.mu.Unlock()
+
+	err := a.write(diff)
+	if err != nil {
+		return err
+	}
+
+	return a.file.Sync()
+}
+
+func (a *archive) index(diff StateDiff) {
+	a.hashes = append(a.hashes, diff.Hash)
+	for account, state := range diff.Accounts {
+		a.accounts[account] = append(a.accounts[account], state)
+	}
+}
+
+func (a *archive) write(diff StateDiff) error {
+	diffJson, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.file.Write(append(diffJson, '\n'))
+	return err
+}
+
+func (a *archive) accountAt(account common.Address, height uint64) (AccountState, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if height >= uint64(len(a.hashes)) {
+		return AccountState{}, fmt.Errorf("block %d isn't archived, the archive holds %d blocks", height, len(a.hashes))
+	}
+
+	res := AccountState{Number: height, Hash: a.hashes[height], Balance: a.genesis[account]}
+
+	changes := a.accounts[account]
+	i := sort.Search(len(changes), func(i int) bool {
+		return changes[i].Number > height
+	})
+	if i > 0 {
+		res.Balance = changes[i-1].Balance
+		res.Nonce = changes[i-1].Nonce
+	}
+
+	return res, nil
+}
+
+func (a *archive) close() {
+	a.file.Close()
+}
+
+// NewStateDiff collects the accounts the block touched from the state the
+// block was just applied to
+func NewStateDiff(b Block, hash Hash, s *State) StateDiff {
+	diff := StateDiff{Number: b.Header.Number, Hash: hash, Accounts: make(map[common.Address]AccountState)}
+
+	touched := []common.Address{b.Header.Miner}
+	for _, tx := range b.TXs {
+		touched = append(touched, tx.From, tx.To)
+	}
+
+	for _, account := range touched {
+		diff.Accounts[account] = AccountState{
+			Number:  b.Header.Number,
+			Hash:    hash,
+			Balance: s.Balances[account],
+			Nonce:   s.AccountsToNonce[account],
+		}
+	}
+
+	return diff
+}
+
+func getArchiveDbFilePath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "archive.db")
+}
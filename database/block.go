@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -43,24 +44,40 @@ type BlockHeader struct {
 	Nonce  uint32         `json:"nonce"`
 	Time   uint64         `json:"time"`
 	Miner  common.Address `json:"miner"`
+	// Version selects the encoding the block is hashed over, see
+	// EncodingVersionJSON and EncodingVersionCanonical
+	Version uint8 `json:"version,omitempty"`
 }
 
 type BlockFS struct {
 	Key   Hash  `json:"hash"`
 	Value Block `json:"block"`
+	// Pruned blocks only have their header, see State.Prune
+	Pruned bool `json:"pruned,omitempty"`
 }
 
 func NewBlock(parent Hash, number uint64, nonce uint32, time uint64, miner common.Address, txs []SignedTx) Block {
-	return Block{BlockHeader{parent, number, nonce, time, miner}, txs}
+	return Block{BlockHeader{parent, number, nonce, time, miner, EncodingVersionJSON}, txs}
 }
 
 func (b Block) Hash() (Hash, error) {
-	blockJson, err := json.Marshal(b)
+	blockBytes, err := b.encodeForHash()
 	if err != nil {
 		return Hash{}, err
 	}
 
-	return sha256.Sum256(blockJson), nil
+	return sha256.Sum256(blockBytes), nil
+}
+
+func (b Block) encodeForHash() ([]byte, error) {
+	switch b.Header.Version {
+	case EncodingVersionJSON:
+		return json.Marshal(b)
+	case EncodingVersionCanonical:
+		return encodeCanonicalHeader(b)
+	default:
+		return nil, fmt.Errorf("unknown block encoding version %d", b.Header.Version)
+	}
 }
 
 func IsBlockHashValid(hash Hash) bool {
@@ -69,3 +86,62 @@ func IsBlockHashValid(hash Hash) bool {
 		fmt.Sprintf("%x", hash[2]) == "0" &&
 		fmt.Sprintf("%x", hash[3]) != "0"
 }
+
+// NonceHasher hashes a block over and over for different header nonces without
+// re-encoding the rest of the block on every attempt. It isn't safe for
+// concurrent use, every mining worker needs its own.
+type NonceHasher struct {
+	prefix []byte
+	suffix []byte
+	buf    []byte
+	binary bool
+}
+
+func NewNonceHasher(b Block) (*NonceHasher, error) {
+	b.Header.Nonce = 0
+	if b.Header.Version == EncodingVersionCanonical {
+		header, err := encodeCanonicalHeader(b)
+		if err != nil {
+			return nil, err
+		}
+
+		return &NonceHasher{
+			prefix: header[:canonicalHeaderNonceOffset],
+			buf:    make([]byte, 0, canonicalHeaderLen),
+			binary: true,
+		}, nil
+	}
+
+	blockJson, err := b.encodeForHash()
+	if err != nil {
+		return nil, err
+	}
+
+	// The header is encoded before the payload, so the first nonce key is
+	// always the header's and never one of the TXs'
+	nonceKey := []byte(`"nonce":`)
+	i := bytes.Index(blockJson, nonceKey)
+	if i < 0 {
+		return nil, fmt.Errorf("unable to locate nonce in encoded block")
+	}
+	i += len(nonceKey)
+
+	return &NonceHasher{
+		prefix: blockJson[:i],
+		suffix: blockJson[i+1:],
+		buf:    make([]byte, 0, len(blockJson)+10),
+	}, nil
+}
+
+func (h *NonceHasher) Hash(nonce uint32) Hash {
+	h.buf = append(h.buf[:0], h.prefix...)
+	if h.binary {
+		h.buf = append(h.buf, byte(nonce>>24), byte(nonce>>16), byte(nonce>>8), byte(nonce))
+		return sha256.Sum256(h.buf)
+	}
+
+	h.buf = strconv.AppendUint(h.buf, uint64(nonce), 10)
+	h.buf = append(h.buf, h.suffix...)
+
+	return sha256.Sum256(h.buf)
+}
@@ -3,18 +3,24 @@ package database
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"os"
 	"reflect"
 )
 
-func GetBlocksAfter(hash Hash, dataDir string) ([]Block, error) {
+// GetBlocksAfter returns up to limit blocks following the block with the given
+// hash, skipping the first offset of them. An empty hash starts from the first
+// block in the DB and a limit of 0 returns every remaining block.
+func GetBlocksAfter(hash Hash, dataDir string, offset, limit uint64) ([]Block, error) {
 	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_RDONLY, 0600)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
 	blocks := make([]Block, 0)
 	shouldCollect := false
+	skipped := uint64(0)
 
 	if reflect.DeepEqual(hash, Hash{}) {
 		shouldCollect = true
@@ -33,7 +39,20 @@ func GetBlocksAfter(hash Hash, dataDir string) ([]Block, error) {
 		}
 
 		if shouldCollect {
+			if skipped < offset {
+				skipped++
+				continue
+			}
+
+			if blocksFs.Pruned {
+				return nil, fmt.Errorf("block %d is pruned, its TXs are no longer available", blocksFs.Value.Header.Number)
+			}
+
 			blocks = append(blocks, blocksFs.Value)
+			if limit > 0 && uint64(len(blocks)) == limit {
+				break
+			}
+
 			continue
 		}
 
@@ -44,3 +63,39 @@ func GetBlocksAfter(hash Hash, dataDir string) ([]Block, error) {
 
 	return blocks, nil
 }
+
+// GetBlocksFrom returns up to limit blocks starting from the block with the
+// given number. A limit of 0 returns every remaining block.
+func GetBlocksFrom(number uint64, dataDir string, limit uint64) ([]Block, error) {
+	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	blocks := make([]Block, 0)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var blocksFs BlockFS
+		err = json.Unmarshal(scanner.Bytes(), &blocksFs)
+		if err != nil {
+			return nil, err
+		}
+
+		if blocksFs.Value.Header.Number < number {
+			continue
+		}
+
+		if blocksFs.Pruned {
+			return nil, fmt.Errorf("block %d is pruned, its TXs are no longer available", blocksFs.Value.Header.Number)
+		}
+
+		blocks = append(blocks, blocksFs.Value)
+		if limit > 0 && uint64(len(blocks)) == limit {
+			break
+		}
+	}
+
+	return blocks, scanner.Err()
+}
@@ -0,0 +1,27 @@
+package database
+
+// Demo accounts funded by the dev genesis. Their keystore files are committed
+// to the repo, so they must never hold anything of value outside of --dev.
+const DevToshiAccount = "0xe5ED8C1829192380205b1E7BB5A3F44baf181d25"
+const DevJTangAccount = "0xf70D226203FDDa745C3B160D92Ee665A71191D6a"
+const DevQudsiiAccount = "0x7573428c0394133cC5A3FC5533b9B04241D1271E"
+
+const devGenesisJson = `
+{
+  "genesis_time": "2020-06-07T00:00:00.000000000Z",
+  "chain_id": "the-blockchain-shiba-ledger",
+  "balances": {
+    "0xe5ED8C1829192380205b1E7BB5A3F44baf181d25": 1000000
+  }
+}`
+
+// InitDevDataDir initialises the data dir with the dev genesis which funds
+// the demo accounts
+func InitDevDataDir(dataDir string) error {
+	genesis, err := parseGenesis([]byte(devGenesisJson))
+	if err != nil {
+		return err
+	}
+
+	return InitDataDir(dataDir, genesis)
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Blocks and TXs are hashed, and TXs signed, over an encoding chosen by their
+// version. Version 0 is the legacy JSON encoding, which ties consensus to the
+// field order and formatting of Go's encoding/json. Version 1 is a canonical
+// encoding: RLP for TXs and a fixed binary layout for block headers.
+const (
+	EncodingVersionJSON      = uint8(0)
+	EncodingVersionCanonical = uint8(1)
+)
+
+// DefaultCanonicalEncodingFork is the first block number which must use the
+// canonical encoding on chains whose genesis doesn't specify its own fork.
+const DefaultCanonicalEncodingFork = uint64(1000)
+
+// Canonical block header layout, all integers are big endian:
+//
+//	version    1 byte
+//	parent    32 bytes
+//	number     8 bytes
+//	time       8 bytes
+//	miner     20 bytes
+//	txs root  32 bytes
+//	nonce      4 bytes
+//
+// The nonce is last so that miners can encode everything else once.
+const canonicalHeaderLen = 1 + 32 + 8 + 8 + common.AddressLength + 32 + 4
+const canonicalHeaderNonceOffset = canonicalHeaderLen - 4
+
+type canonicalTx struct {
+	Version uint8
+	From    common.Address
+	To      common.Address
+	Value   uint64
+	Nonce   uint64
+	Data    string
+	Time    uint64
+}
+
+type canonicalSignedTx struct {
+	Tx  canonicalTx
+	Sig []byte
+}
+
+type canonicalMultisigSignedTx struct {
+	Tx        canonicalTx
+	Threshold uint64
+	Owners    []common.Address
+	Sigs      [][]byte
+}
+
+func newCanonicalTx(t Tx) canonicalTx {
+	return canonicalTx{t.Version, t.From, t.To, uint64(t.Value), uint64(t.Nonce), t.Data, t.Time}
+}
+
+func encodeCanonicalTx(t Tx) ([]byte, error) {
+	return rlp.EncodeToBytes(newCanonicalTx(t))
+}
+
+func encodeCanonicalSignedTx(t SignedTx) ([]byte, error) {
+	if t.Multisig != nil {
+		return rlp.EncodeToBytes(canonicalMultisigSignedTx{
+			newCanonicalTx(t.Tx),
+			uint64(t.Multisig.Threshold),
+			t.Multisig.Owners,
+			t.Sigs,
+		})
+	}
+
+	return rlp.EncodeToBytes(canonicalSignedTx{newCanonicalTx(t.Tx), t.Sig})
+}
+
+func encodeCanonicalHeader(b Block) ([]byte, error) {
+	txsRoot, err := TXsRoot(b.TXs)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, canonicalHeaderLen)
+	header = append(header, b.Header.Version)
+	header = append(header, b.Header.Parent[:]...)
+	header = appendUint64(header, b.Header.Number)
+	header = appendUint64(header, b.Header.Time)
+	header = append(header, b.Header.Miner[:]...)
+	header = append(header, txsRoot[:]...)
+
+	nonce := make([]byte, 4)
+	binary.BigEndian.PutUint32(nonce, b.Header.Nonce)
+
+	return append(header, nonce...), nil
+}
+
+// TXsRoot commits a canonical block header to the block's TXs, in order
+func TXsRoot(txs []SignedTx) (Hash, error) {
+	hashes := make([]byte, 0, len(txs)*32)
+	for _, tx := range txs {
+		if tx.Version != EncodingVersionCanonical {
+			return Hash{}, fmt.Errorf("canonical blocks can only contain canonical TXs, got TX version %d", tx.Version)
+		}
+
+		txHash, err := tx.Hash()
+		if err != nil {
+			return Hash{}, err
+		}
+
+		hashes = append(hashes, txHash[:]...)
+	}
+
+	return sha256.Sum256(hashes), nil
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	return append(b, buf...)
+}
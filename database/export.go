@@ -0,0 +1,321 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+const ExportFormat = "tbs-chain-export"
+const ExportVersion = 1
+
+// An export is a gzip compressed stream of JSON lines: a header, one line per
+// block and a trailer holding the SHA-256 of every line before it, so a
+// truncated or tampered file is rejected before any of its blocks is applied.
+type exportRecord struct {
+	Header  *ExportHeader  `json:"header,omitempty"`
+	Block   *BlockFS       `json:"block,omitempty"`
+	Trailer *ExportTrailer `json:"trailer,omitempty"`
+}
+
+type ExportHeader struct {
+	Format      string `json:"format"`
+	Version     int    `json:"version"`
+	ChainID     string `json:"chain_id"`
+	GenesisHash Hash   `json:"genesis_hash"`
+	From        uint64 `json:"from"`
+}
+
+type ExportTrailer struct {
+	Blocks   uint64 `json:"blocks"`
+	To       uint64 `json:"to"`
+	Checksum string `json:"sha256"`
+}
+
+type ImportReport struct {
+	Imported uint64
+	Skipped  uint64
+	Height   uint64
+}
+
+// ExportBlocks writes the blocks numbered from to to, inclusive, of the data
+// dir's chain to w
+func ExportBlocks(dataDir string, from, to uint64, w io.Writer) (ExportTrailer, error) {
+	gen, err := LoadDataDirGenesis(dataDir)
+	if err != nil {
+		return ExportTrailer{}, err
+	}
+
+	genesisHash, err := gen.Hash()
+	if err != nil {
+		return ExportTrailer{}, err
+	}
+
+	blocks, err := os.Open(getBlocksDbFilePath(dataDir))
+	if err != nil {
+		return ExportTrailer{}, err
+	}
+	defer blocks.Close()
+
+	zw := gzip.NewWriter(w)
+	checksum := sha256.New()
+	out := io.MultiWriter(zw, checksum)
+
+	header := ExportHeader{Format: ExportFormat, Version: ExportVersion, ChainID: gen.ChainID, GenesisHash: genesisHash, From: from}
+	err = writeExportRecord(out, exportRecord{Header: &header})
+	if err != nil {
+		return ExportTrailer{}, err
+	}
+
+	trailer := ExportTrailer{}
+	reader := bufio.NewReader(blocks)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return ExportTrailer{}, err
+		}
+
+		blockFsJson := bytes.TrimSpace(line)
+		if len(blockFsJson) == 0 {
+			break
+		}
+
+		var blockFs BlockFS
+		err = json.Unmarshal(blockFsJson, &blockFs)
+		if err != nil {
+			return ExportTrailer{}, fmt.Errorf("unable to decode block record in '%s'. %s", getBlocksDbFilePath(dataDir), err.Error())
+		}
+
+		number := blockFs.Value.Header.Number
+		if number < from {
+			continue
+		}
+		if number > to {
+			break
+		}
+		if blockFs.Pruned {
+			return ExportTrailer{}, fmt.Errorf("block %d is pruned, export from a block whose TXs are kept", number)
+		}
+
+		err = writeExportRecord(out, exportRecord{Block: &blockFs})
+		if err != nil {
+			return ExportTrailer{}, err
+		}
+
+		trailer.Blocks++
+		trailer.To = number
+	}
+
+	if trailer.Blocks == 0 {
+		if to == math.MaxUint64 {
+			return ExportTrailer{}, fmt.Errorf("no blocks from %d onwards to export", from)
+		}
+
+		return ExportTrailer{}, fmt.Errorf("no blocks from %d to %d to export", from, to)
+	}
+
+	trailer.Checksum = hex.EncodeToString(checksum.Sum(nil))
+	err = writeExportRecord(zw, exportRecord{Trailer: &trailer})
+	if err != nil {
+		return ExportTrailer{}, err
+	}
+
+	return trailer, zw.Close()
+}
+
+// ImportBlocks applies every block of an export to the data dir's chain
+// through the same validation as blocks mined or synced. Blocks the chain
+// already has are skipped, so an interrupted import can be run again to
+// resume it.
+func ImportBlocks(dataDir, path string) (ImportReport, error) {
+	header, err := verifyExport(path)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	gen, err := LoadDataDirGenesis(dataDir)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	genesisHash, err := gen.Hash()
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	if header.GenesisHash != genesisHash {
+		return ImportReport{}, fmt.Errorf("export is of chain '%s' with genesis %s, data dir is of chain '%s' with genesis %s", header.ChainID, header.GenesisHash.Hex(), gen.ChainID, genesisHash.Hex())
+	}
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	defer state.Close()
+
+	report := ImportReport{}
+	err = readExport(path, func(record exportRecord) error {
+		if record.Block == nil {
+			return nil
+		}
+
+		b := record.Block.Value
+		next := state.NextBlockNumber()
+
+		if b.Header.Number < next {
+			// The chain may only be resumed if it's the one being imported
+			if b.Header.Number == state.LastBlock().Header.Number && record.Block.Key != state.LatestBlockHash() {
+				return fmt.Errorf("export diverges from the local chain at block %d, local hash is %s not %s", b.Header.Number, state.LatestBlockHash().Hex(), record.Block.Key.Hex())
+			}
+
+			report.Skipped++
+			return nil
+		}
+
+		if b.Header.Number > next {
+			return fmt.Errorf("export is missing blocks %d to %d, the next local block is %d", next, b.Header.Number-1, next)
+		}
+
+		hash, err := b.Hash()
+		if err != nil {
+			return err
+		}
+
+		if hash != record.Block.Key {
+			return fmt.Errorf("block %d hashes to %s not %s", b.Header.Number, hash.Hex(), record.Block.Key.Hex())
+		}
+
+		_, err = state.AddBlock(b)
+		if err != nil {
+			return fmt.Errorf("unable to import block %d. %s", b.Header.Number, err.Error())
+		}
+
+		report.Imported++
+		return nil
+	})
+
+	report.Height = state.LastBlock().Header.Number
+	return report, err
+}
+
+// verifyExport reads the whole export once, checking its format, that every
+// record is there and that none was altered
+func verifyExport(path string) (ExportHeader, error) {
+	var header *ExportHeader
+	var trailer *ExportTrailer
+	blocks := uint64(0)
+	checksum := sha256.New()
+
+	err := readExportLines(path, func(line []byte, record exportRecord) error {
+		switch {
+		case trailer != nil:
+			return fmt.Errorf("unexpected record after the export trailer")
+		case header == nil && record.Header == nil:
+			return fmt.Errorf("export doesn't start with a header")
+		case record.Header != nil:
+			if header != nil {
+				return fmt.Errorf("unexpected second export header")
+			}
+			header = record.Header
+		case record.Block != nil:
+			blocks++
+		case record.Trailer != nil:
+			trailer = record.Trailer
+			return nil
+		}
+
+		checksum.Write(line)
+		return nil
+	})
+	if err != nil {
+		return ExportHeader{}, err
+	}
+
+	if header == nil || header.Format != ExportFormat {
+		return ExportHeader{}, fmt.Errorf("'%s' isn't a chain export", path)
+	}
+
+	if header.Version != ExportVersion {
+		return ExportHeader{}, fmt.Errorf("unsupported chain export version %d", header.Version)
+	}
+
+	if trailer == nil {
+		return ExportHeader{}, fmt.Errorf("chain export '%s' is truncated, its trailer is missing", path)
+	}
+
+	if trailer.Blocks != blocks {
+		return ExportHeader{}, fmt.Errorf("chain export '%s' should have %d blocks, found %d", path, trailer.Blocks, blocks)
+	}
+
+	if sum := hex.EncodeToString(checksum.Sum(nil)); sum != trailer.Checksum {
+		return ExportHeader{}, fmt.Errorf("chain export '%s' checksum is %s not %s", path, sum, trailer.Checksum)
+	}
+
+	return *header, nil
+}
+
+func readExport(path string, fn func(record exportRecord) error) error {
+	return readExportLines(path, func(line []byte, record exportRecord) error {
+		return fn(record)
+	})
+}
+
+// readExportLines decompresses an export and calls fn with every line, newline
+// included, and the record it holds
+func readExportLines(path string, fn func(line []byte, record exportRecord) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("unable to decompress chain export '%s'. %s", path, err.Error())
+	}
+	defer zr.Close()
+
+	reader := bufio.NewReader(zr)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("unable to read chain export '%s'. %s", path, err.Error())
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			return nil
+		}
+
+		var record exportRecord
+		jsonErr := json.Unmarshal(line, &record)
+		if jsonErr != nil {
+			return fmt.Errorf("unable to decode chain export '%s'. %s", path, jsonErr.Error())
+		}
+
+		fnErr := fn(line, record)
+		if fnErr != nil {
+			return fnErr
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func writeExportRecord(w io.Writer, record exportRecord) error {
+	recordJson, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(recordJson, '\n'))
+	return err
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestExportImportBlocks(t *testing.T) {
+	srcDir := setupTestDataDir(t)
+	defer os.RemoveAll(srcDir)
+
+	state, err := NewStateFromDisk(srcDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+	addTestBlocks(t, state, 1)
+	state.Close()
+
+	exportPath := filepath.Join(srcDir, "chain.gz")
+	exportFile, err := os.Create(exportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trailer, err := ExportBlocks(srcDir, 0, math.MaxUint64, exportFile)
+	exportFile.Close()
+	if err != nil {
+		t.Fatalf("unable to export blocks. %s", err.Error())
+	}
+
+	if trailer.Blocks != 1 || trailer.To != 0 {
+		t.Fatalf("expected block 0 to be exported, exported %d up to %d", trailer.Blocks, trailer.To)
+	}
+
+	gen, err := LoadDataDirGenesis(srcDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dstDir, err := ioutil.TempDir("", "tbs_import_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	err = InitDataDir(dstDir, gen)
+	if err != nil {
+		t.Fatalf("unable to initialise data dir. %s", err.Error())
+	}
+
+	report, err := ImportBlocks(dstDir, exportPath)
+	if err != nil {
+		t.Fatalf("unable to import blocks. %s", err.Error())
+	}
+
+	if report.Imported != 1 || report.Height != 0 {
+		t.Fatalf("expected 1 block to be imported up to height 0, imported %d up to %d", report.Imported, report.Height)
+	}
+
+	report, err = ImportBlocks(dstDir, exportPath)
+	if err != nil {
+		t.Fatalf("unable to resume import. %s", err.Error())
+	}
+
+	if report.Imported != 0 || report.Skipped != 1 {
+		t.Fatalf("expected resumed import to skip the imported block, imported %d and skipped %d", report.Imported, report.Skipped)
+	}
+}
+
+func TestImportBlocksRejectsTamperedExport(t *testing.T) {
+	dataDir := setupTestDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	gen, err := LoadDataDirGenesis(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genesisHash, err := gen.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	header := ExportHeader{Format: ExportFormat, Version: ExportVersion, ChainID: gen.ChainID, GenesisHash: genesisHash}
+	records := []exportRecord{
+		{Header: &header},
+		{Block: &BlockFS{Value: NewBlock(Hash{}, 0, 0, 0, common.HexToAddress("0x02"), []SignedTx{})}},
+		{Trailer: &ExportTrailer{Blocks: 1, Checksum: "00"}},
+	}
+	for _, record := range records {
+		err = writeExportRecord(zw, record)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	zw.Close()
+
+	exportPath := filepath.Join(dataDir, "chain.gz")
+	err = ioutil.WriteFile(exportPath, buf.Bytes(), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ImportBlocks(dataDir, exportPath)
+	if err == nil {
+		t.Fatalf("expected export with a wrong checksum to be rejected")
+	}
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if state.NextBlockNumber() != 0 {
+		t.Fatalf("expected no block to be imported from a tampered export")
+	}
+}
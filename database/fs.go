@@ -1,21 +1,25 @@
 package database
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 )
 
-func InitDataDirIfNotExists(dataDir string, genesis []byte) error {
-	if fileExists(getGenesisJsonFilePath(dataDir)) {
-		return nil
+// InitDataDir initialises the data dir with the genesis. A data dir which is
+// already initialised is left untouched, as long as it was initialised with
+// the same genesis.
+func InitDataDir(dataDir string, genesis Genesis) error {
+	if IsDataDirInitialised(dataDir) {
+		return verifyDataDirGenesis(dataDir, genesis)
 	}
 
 	if err := os.MkdirAll(getDatabaseDirPath(dataDir), os.ModePerm); err != nil {
 		return err
 	}
 
-	if err := writeGenesisToDisk(getGenesisJsonFilePath(dataDir), genesis); err != nil {
+	if err := genesis.Save(getGenesisJsonFilePath(dataDir)); err != nil {
 		return err
 	}
 
@@ -26,6 +30,45 @@ func InitDataDirIfNotExists(dataDir string, genesis []byte) error {
 	return nil
 }
 
+func verifyDataDirGenesis(dataDir string, genesis Genesis) error {
+	expected, err := genesis.Hash()
+	if err != nil {
+		return err
+	}
+
+	existing, err := LoadDataDirGenesis(dataDir)
+	if err != nil {
+		return err
+	}
+
+	existingHash, err := existing.Hash()
+	if err != nil {
+		return err
+	}
+
+	if existingHash != expected {
+		return fmt.Errorf("data dir '%s' was initialised with genesis %s of chain '%s', not genesis %s of chain '%s'", dataDir, existingHash.Hex(), existing.ChainID, expected.Hex(), genesis.ChainID)
+	}
+
+	return nil
+}
+
+// CheckDataDirWritable makes sure new blocks can still be written to the
+// data dir by creating and removing a temporary file next to the blocks DB
+func CheckDataDirWritable(dataDir string) error {
+	f, err := ioutil.TempFile(getDatabaseDirPath(dataDir), ".writable-")
+	if err != nil {
+		return fmt.Errorf("data dir '%s' isn't writable. %s", dataDir, err.Error())
+	}
+
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func IsDataDirInitialised(dataDir string) bool {
+	return fileExists(getGenesisJsonFilePath(dataDir))
+}
+
 func getDatabaseDirPath(dataDir string) string {
 	return filepath.Join(dataDir, "database")
 }
@@ -1,40 +1,83 @@
 package database
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"io/ioutil"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 )
 
-var genesisJson = `
-{
-  "genesis_time": "2020-06-07T00:00:00.000000000Z",
-  "chain_id": "the-blockchain-shiba-ledger",
-  "balances": {
-    "0xe5ED8C1829192380205b1E7BB5A3F44baf181d25": 1000000
-  }
-}`
-
 type Genesis struct {
-	Balances map[common.Address]uint `json:"balances"`
+	GenesisTime time.Time               `json:"genesis_time"`
+	ChainID     string                  `json:"chain_id"`
+	Balances    map[common.Address]uint `json:"balances"`
+	// CanonicalEncodingFork is the first block number hashed with the canonical
+	// encoding, DefaultCanonicalEncodingFork is used when it's not set
+	CanonicalEncodingFork *uint64 `json:"canonical_encoding_fork,omitempty"`
+}
+
+func NewGenesis(chainID string, balances map[common.Address]uint) Genesis {
+	return Genesis{
+		GenesisTime: time.Now().UTC(),
+		ChainID:     chainID,
+		Balances:    balances,
+	}
+}
+
+func (g Genesis) Encode() ([]byte, error) {
+	return json.MarshalIndent(g, "", "  ")
+}
+
+// Hash identifies the genesis independently of the formatting of the file it
+// was loaded from, nodes on the same chain must share the same genesis hash
+func (g Genesis) Hash() (Hash, error) {
+	genesisJson, err := json.Marshal(g)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	return sha256.Sum256(genesisJson), nil
+}
+
+func (g Genesis) canonicalEncodingFork() uint64 {
+	if g.CanonicalEncodingFork == nil {
+		return DefaultCanonicalEncodingFork
+	}
+
+	return *g.CanonicalEncodingFork
 }
 
-func loadGenesis(path string) (Genesis, error) {
+func LoadGenesis(path string) (Genesis, error) {
 	content, err := ioutil.ReadFile(path)
 	if err != nil {
 		return Genesis{}, err
 	}
 
+	return parseGenesis(content)
+}
+
+// LoadDataDirGenesis loads the genesis the data dir was initialised with
+func LoadDataDirGenesis(dataDir string) (Genesis, error) {
+	return LoadGenesis(getGenesisJsonFilePath(dataDir))
+}
+
+func (g Genesis) Save(path string) error {
+	genesisJson, err := g.Encode()
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, genesisJson, 0644)
+}
+
+func parseGenesis(content []byte) (Genesis, error) {
 	var loadedGenesis Genesis
-	err = json.Unmarshal(content, &loadedGenesis)
+	err := json.Unmarshal(content, &loadedGenesis)
 	if err != nil {
 		return Genesis{}, err
 	}
 
 	return loadedGenesis, nil
 }
-
-func writeGenesisToDisk(path string, genesis []byte) error {
-	return ioutil.WriteFile(path, genesis, 0644)
-}
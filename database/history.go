@@ -0,0 +1,99 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// StateAt recomputes the balances and nonces as of the block with the given
+// height by replaying the chain from the nearest snapshot, or from the
+// genesis if there's none. The state returned is read only, it can't add
+// blocks.
+func StateAt(dataDir string, height uint64) (*State, error) {
+	if !IsDataDirInitialised(dataDir) {
+		return nil, fmt.Errorf("data dir '%s' isn't initialised", dataDir)
+	}
+
+	gen, err := LoadDataDirGenesis(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	state := newStateFromGenesis(dataDir, gen, nil)
+
+	snapshot, ok, err := loadNearestSnapshot(dataDir, height)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		state.restoreSnapshot(snapshot)
+	}
+
+	info, pruned, err := loadPruneInfo(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if pruned && height < info.PrunedTo && (!ok || snapshot.Number != height) {
+		return nil, fmt.Errorf("unable to compute state at height %d, the TXs of the blocks up to %d are pruned", height, info.PrunedTo)
+	}
+
+	report, err := replayBlocksOnto(state, height)
+	if err != nil && ok {
+		// The snapshot is stale, the chain was cut below it since
+		state.logger.Warn("Ignoring snapshot which isn't part of the chain", "number", snapshot.Number, "err", err)
+		state = newStateFromGenesis(dataDir, gen, nil)
+		report, err = replayBlocksOnto(state, height)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if state.hasGenesisBlock && state.lastBlock.Header.Number >= height {
+		return state, nil
+	}
+
+	if report.BadBlock != nil {
+		return nil, fmt.Errorf("unable to compute state at height %d, block %d is invalid. %s", height, report.BadBlock.Number, report.BadBlock.Err.Error())
+	}
+
+	if !state.hasGenesisBlock {
+		return nil, fmt.Errorf("unable to compute state at height %d, the chain has no blocks", height)
+	}
+
+	return nil, fmt.Errorf("unable to compute state at height %d, the chain height is %d", height, state.lastBlock.Header.Number)
+}
+
+// AccountAt returns the balance and nonce of the account as of the block with
+// the given height. In archive mode they're looked up in the archived state
+// diffs, otherwise the chain is replayed from the nearest snapshot.
+func (s *State) AccountAt(account common.Address, height uint64) (AccountState, error) {
+	if !s.hasGenesisBlock || height > s.lastBlock.Header.Number {
+		return AccountState{}, fmt.Errorf("block %d doesn't exist, the next block is %d", height, s.NextBlockNumber())
+	}
+
+	if s.archive != nil {
+		return s.archive.accountAt(account, height)
+	}
+
+	state, err := StateAt(s.dataDir, height)
+	if err != nil {
+		return AccountState{}, err
+	}
+
+	return AccountState{
+		Number:  height,
+		Hash:    state.lastBlockHash,
+		Balance: state.Balances[account],
+		Nonce:   state.AccountsToNonce[account],
+	}, nil
+}
+
+func (s *State) BalanceAt(account common.Address, height uint64) (uint, error) {
+	state, err := s.AccountAt(account, height)
+	if err != nil {
+		return 0, err
+	}
+
+	return state.Balance, nil
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestStateAt(t *testing.T) {
+	dataDir := setupTestDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+	addTestBlocks(t, state, 1)
+	state.Close()
+
+	state, err = StateAt(dataDir, 0)
+	if err != nil {
+		t.Fatalf("unable to compute state at height 0. %s", err.Error())
+	}
+
+	if balance := state.Balances[common.HexToAddress("0x02")]; balance != BlockReward {
+		t.Fatalf("expected miner balance at height 0 to be %d, got %d", BlockReward, balance)
+	}
+
+	_, err = StateAt(dataDir, 1)
+	if err == nil {
+		t.Fatalf("expected state above the chain height to be rejected")
+	}
+}
+
+func TestAccountAt(t *testing.T) {
+	dataDir := setupTestDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewArchiveStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load archive state. %s", err.Error())
+	}
+	state.snapshotInterval = 1
+	addTestBlocks(t, state, 2)
+	state.Close()
+
+	snapshots, err := listSnapshots(dataDir)
+	if err != nil || len(snapshots) != 1 || snapshots[0] != 1 {
+		t.Fatalf("expected a snapshot of block 1, found %v", snapshots)
+	}
+
+	miner := common.HexToAddress("0x02")
+	assertBalanceAt := func(state *State, height uint64, expected uint) {
+		balance, err := state.BalanceAt(miner, height)
+		if err != nil {
+			t.Fatalf("unable to get balance at height %d. %s", height, err.Error())
+		}
+
+		if balance != expected {
+			t.Fatalf("expected balance at height %d to be %d, got %d", height, expected, balance)
+		}
+	}
+
+	state, err = NewArchiveStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to reload archive state. %s", err.Error())
+	}
+	assertBalanceAt(state, 0, BlockReward)
+	assertBalanceAt(state, 1, 2*BlockReward)
+	state.Close()
+
+	// Replayed from the genesis and from the snapshot of block 1
+	state, err = NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+	assertBalanceAt(state, 0, BlockReward)
+	assertBalanceAt(state, 1, 2*BlockReward)
+	state.Close()
+
+	_, err = TruncateDataDir(dataDir, 0)
+	if err != nil {
+		t.Fatalf("unable to truncate data dir. %s", err.Error())
+	}
+
+	state, err = NewArchiveStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to reload archive state. %s", err.Error())
+	}
+	defer state.Close()
+
+	assertBalanceAt(state, 0, BlockReward)
+	if _, err = state.BalanceAt(miner, 1); err == nil {
+		t.Fatalf("expected balance above the truncated chain height to be rejected")
+	}
+
+	if len(state.archive.hashes) != 1 {
+		t.Fatalf("expected archive to be cut back to 1 block, holds %d", len(state.archive.hashes))
+	}
+}
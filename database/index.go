@@ -0,0 +1,80 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// blockRecord locates the record of a block in the blocks DB
+type blockRecord struct {
+	offset int64
+	size   int64
+}
+
+// blockIndex locates every record of the blocks DB, in chain order, so blocks
+// are read straight from their offset instead of scanning the DB each time
+type blockIndex struct {
+	records   []blockRecord
+	positions map[Hash]int
+}
+
+func newBlockIndex() *blockIndex {
+	return &blockIndex{positions: make(map[Hash]int)}
+}
+
+func (i *blockIndex) add(hash Hash, offset, size int64) {
+	i.positions[hash] = len(i.records)
+	i.records = append(i.records, blockRecord{offset, size})
+}
+
+// BlocksAfter returns up to limit blocks following the block with the given
+// hash, skipping the first offset of them, just like GetBlocksAfter but
+// without scanning the blocks DB. A limit of 0 returns every remaining block.
+func (s *State) BlocksAfter(hash Hash, offset, limit uint64) ([]Block, error) {
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	start := 0
+	if !hash.IsEmpty() {
+		position, ok := s.index.positions[hash]
+		if !ok {
+			return []Block{}, nil
+		}
+		start = position + 1
+	}
+
+	return s.readBlocks(start+int(offset), limit)
+}
+
+// readBlocks reads up to limit blocks from the given record position on,
+// dbMu must be held
+func (s *State) readBlocks(position int, limit uint64) ([]Block, error) {
+	blocks := make([]Block, 0)
+	for ; position < len(s.index.records); position++ {
+		record := s.index.records[position]
+
+		blockFsJson := make([]byte, record.size)
+		_, err := s.dbFile.ReadAt(blockFsJson, record.offset)
+		if err != nil {
+			return nil, err
+		}
+
+		var blockFs BlockFS
+		err = json.Unmarshal(bytes.TrimSpace(blockFsJson), &blockFs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block record at offset %d of the blocks DB. %s", record.offset, err.Error())
+		}
+
+		if blockFs.Pruned {
+			return nil, fmt.Errorf("block %d is pruned, its TXs are no longer available", blockFs.Value.Header.Number)
+		}
+
+		blocks = append(blocks, blockFs.Value)
+		if limit > 0 && uint64(len(blocks)) == limit {
+			break
+		}
+	}
+
+	return blocks, nil
+}
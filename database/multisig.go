@@ -0,0 +1,105 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const multisigAddressPrefix = "tbs-multisig"
+
+// Multisig describes an M-of-N account which is controlled by its owners
+// rather than a single key. Its address is derived from the threshold and the
+// sorted owners, so TXs from it carry the full description to be verified.
+type Multisig struct {
+	Threshold uint             `json:"threshold"`
+	Owners    []common.Address `json:"owners"`
+}
+
+func NewMultisig(threshold uint, owners []common.Address) (Multisig, error) {
+	sortedOwners := make([]common.Address, len(owners))
+	copy(sortedOwners, owners)
+	sort.Slice(sortedOwners, func(i, j int) bool {
+		return bytes.Compare(sortedOwners[i][:], sortedOwners[j][:]) < 0
+	})
+
+	m := Multisig{threshold, sortedOwners}
+	err := m.Validate()
+	if err != nil {
+		return Multisig{}, err
+	}
+
+	return m, nil
+}
+
+// Validate checks the owners are sorted without duplicates, so every set of
+// owners has exactly one address, and the threshold can be reached.
+func (m Multisig) Validate() error {
+	if m.Threshold == 0 || m.Threshold > uint(len(m.Owners)) {
+		return fmt.Errorf("multisig threshold must be between 1 and %d, not %d", len(m.Owners), m.Threshold)
+	}
+
+	for i := 1; i < len(m.Owners); i++ {
+		if bytes.Compare(m.Owners[i-1][:], m.Owners[i][:]) >= 0 {
+			return fmt.Errorf("multisig owners must be sorted and unique, '%s' is out of place", m.Owners[i].String())
+		}
+	}
+
+	return nil
+}
+
+func (m Multisig) Address() common.Address {
+	data := []byte(multisigAddressPrefix)
+	threshold := make([]byte, 4)
+	binary.BigEndian.PutUint32(threshold, uint32(m.Threshold))
+	data = append(data, threshold...)
+
+	for _, owner := range m.Owners {
+		data = append(data, owner[:]...)
+	}
+
+	return common.BytesToAddress(crypto.Keccak256(data)[12:])
+}
+
+func (m Multisig) IsOwner(account common.Address) bool {
+	for _, owner := range m.Owners {
+		if owner == account {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isAuthentic checks that enough distinct owners signed the TX hash and that
+// nobody else did
+func (m Multisig) isAuthentic(from common.Address, txHash Hash, sigs [][]byte) (bool, error) {
+	err := m.Validate()
+	if err != nil {
+		return false, err
+	}
+
+	if m.Address() != from {
+		return false, nil
+	}
+
+	signers := make(map[common.Address]bool)
+	for _, sig := range sigs {
+		signer, err := recoverSigner(txHash, sig)
+		if err != nil {
+			return false, err
+		}
+
+		if !m.IsOwner(signer) || signers[signer] {
+			return false, nil
+		}
+
+		signers[signer] = true
+	}
+
+	return uint(len(signers)) >= m.Threshold, nil
+}
@@ -0,0 +1,225 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// pruneInfo records that the blocks DB only holds the headers of the blocks up
+// to PrunedTo, whose state is covered by the snapshot of that very block
+type pruneInfo struct {
+	PrunedTo uint64 `json:"pruned_to"`
+}
+
+// SetPruning makes the state drop the TX bodies of blocks more than keep
+// blocks below the tip, once a snapshot covers them. 0 keeps every block.
+func (s *State) SetPruning(keep uint64) {
+	s.pruneKeep = keep
+}
+
+// LowestFullBlock is the number of the lowest block whose TXs are still in
+// the blocks DB. Blocks below it only have their header.
+func (s *State) LowestFullBlock() uint64 {
+	if !s.pruned {
+		return 0
+	}
+
+	return s.prunedTo + 1
+}
+
+func (s *State) isPruned(number uint64) bool {
+	return s.pruned && number <= s.prunedTo
+}
+
+// Prune rewrites the blocks DB without the TXs of the blocks up to the
+// highest snapshot at least the pruning distance below the tip
+func (s *State) Prune() error {
+	if s.pruneKeep == 0 || !s.hasGenesisBlock || s.lastBlock.Header.Number < s.pruneKeep {
+		return nil
+	}
+
+	snapshot, ok, err := loadNearestSnapshot(s.dataDir, s.lastBlock.Header.Number-s.pruneKeep)
+	if err != nil {
+		return err
+	}
+
+	if !ok || (s.pruned && snapshot.Number <= s.prunedTo) {
+		return nil
+	}
+
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	path := getBlocksDbFilePath(s.dataDir)
+	records, err := writePrunedBlocksDb(path, path+".prune", snapshot)
+	if err != nil {
+		os.Remove(path + ".prune")
+		return err
+	}
+
+	// Saved before the blocks DB is replaced, so a crash in between leaves
+	// full blocks which are skipped on load just like pruned ones
+	err = savePruneInfo(s.dataDir, pruneInfo{snapshot.Number})
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(path+".prune", path)
+	if err != nil {
+		return err
+	}
+
+	dbFile, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+
+	s.dbFile.Close()
+	s.dbFile = dbFile
+	s.index.records = records
+	s.pruned = true
+	s.prunedTo = snapshot.Number
+
+	s.logger.Info("Pruned block bodies", "to", snapshot.Number, "lowest_full_block", s.LowestFullBlock())
+	return nil
+}
+
+// writePrunedBlocksDb copies the blocks DB, dropping the TXs of the blocks up
+// to the snapshot's, and returns where each record was written
+func writePrunedBlocksDb(path, prunedPath string, snapshot Snapshot) ([]blockRecord, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(prunedPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+
+	records := make([]blockRecord, 0)
+	offset := int64(0)
+	snapshotFound := false
+	writer := bufio.NewWriter(dst)
+	reader := bufio.NewReader(src)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		blockFsJson := bytes.TrimSpace(line)
+		if len(blockFsJson) == 0 {
+			break
+		}
+
+		var blockFs BlockFS
+		err = json.Unmarshal(blockFsJson, &blockFs)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode block record in '%s'. %s", path, err.Error())
+		}
+
+		number := blockFs.Value.Header.Number
+		if number == snapshot.Number {
+			if blockFs.Key != snapshot.Hash {
+				return nil, fmt.Errorf("snapshot of block %d is of %s, not %s", number, snapshot.Hash.Hex(), blockFs.Key.Hex())
+			}
+
+			snapshotFound = true
+		}
+
+		if number <= snapshot.Number && !blockFs.Pruned {
+			blockFs.Value.TXs = nil
+			blockFs.Pruned = true
+		}
+
+		blockFsJson, err = json.Marshal(blockFs)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = writer.Write(append(blockFsJson, '\n'))
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, blockRecord{offset, int64(len(blockFsJson) + 1)})
+		offset += int64(len(blockFsJson) + 1)
+	}
+
+	if !snapshotFound {
+		return nil, fmt.Errorf("block %d of the snapshot isn't in the chain", snapshot.Number)
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	return records, dst.Sync()
+}
+
+func loadPruneInfo(dataDir string) (pruneInfo, bool, error) {
+	content, err := ioutil.ReadFile(getPruneInfoFilePath(dataDir))
+	if os.IsNotExist(err) {
+		return pruneInfo{}, false, nil
+	}
+	if err != nil {
+		return pruneInfo{}, false, err
+	}
+
+	var info pruneInfo
+	err = json.Unmarshal(content, &info)
+	if err != nil {
+		return pruneInfo{}, false, fmt.Errorf("unable to decode '%s'. %s", getPruneInfoFilePath(dataDir), err.Error())
+	}
+
+	return info, true, nil
+}
+
+func savePruneInfo(dataDir string, info pruneInfo) error {
+	infoJson, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	path := getPruneInfoFilePath(dataDir)
+	err = ioutil.WriteFile(path+".tmp", infoJson, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// restorePruneSnapshot starts the state from the snapshot the blocks DB was
+// pruned up to, if it was pruned, since the TXs before it are gone
+func (s *State) restorePruneSnapshot() error {
+	info, ok, err := loadPruneInfo(s.dataDir)
+	if err != nil || !ok {
+		return err
+	}
+
+	snapshot, err := loadSnapshot(getSnapshotFilePath(s.dataDir, info.PrunedTo))
+	if err != nil {
+		return fmt.Errorf("blocks DB is pruned up to block %d but its snapshot can't be loaded. %s", info.PrunedTo, err.Error())
+	}
+
+	s.restoreSnapshot(snapshot)
+	s.pruned = true
+	s.prunedTo = info.PrunedTo
+
+	return nil
+}
+
+func getPruneInfoFilePath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "prune.json")
+}
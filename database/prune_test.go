@@ -0,0 +1,88 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestPrune(t *testing.T) {
+	dataDir := setupTestDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+	state.snapshotInterval = 1
+	state.SetPruning(1)
+	addTestBlocks(t, state, 3)
+	checkPrunedBlocksServed(t, state)
+	state.Close()
+
+	if lowest := state.LowestFullBlock(); lowest != 2 {
+		t.Fatalf("expected lowest full block to be 2, got %d", lowest)
+	}
+
+	state, err = NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to reload pruned state. %s", err.Error())
+	}
+	defer state.Close()
+
+	if balance := state.Balances[common.HexToAddress("0x02")]; balance != 3*BlockReward {
+		t.Fatalf("expected miner balance to be %d, got %d", 3*BlockReward, balance)
+	}
+
+	if lowest := state.LowestFullBlock(); lowest != 2 {
+		t.Fatalf("expected reloaded lowest full block to be 2, got %d", lowest)
+	}
+
+	_, err = GetBlocksAfter(Hash{}, dataDir, 0, 0)
+	if err == nil {
+		t.Fatalf("expected pruned blocks not to be served")
+	}
+	checkPrunedBlocksServed(t, state)
+
+	_, err = StateAt(dataDir, 0)
+	if err == nil {
+		t.Fatalf("expected state at a pruned height to be rejected")
+	}
+
+	_, err = StateAt(dataDir, 1)
+	if err != nil {
+		t.Fatalf("unable to compute state at the pruned snapshot. %s", err.Error())
+	}
+
+	_, err = TruncateDataDir(dataDir, 0)
+	if err == nil {
+		t.Fatalf("expected truncating pruned blocks to be rejected")
+	}
+
+	report, err := VerifyDataDir(dataDir)
+	if err != nil || report.BadBlock != nil || report.Height != 2 {
+		t.Fatalf("expected pruned chain to verify up to height 2, got %+v. %v", report, err)
+	}
+
+	_, err = NewArchiveStateFromDisk(dataDir)
+	if err == nil {
+		t.Fatalf("expected archive mode to be rejected on pruned data")
+	}
+}
+
+func checkPrunedBlocksServed(t *testing.T, state *State) {
+	_, err := state.BlocksAfter(Hash{}, 0, 0)
+	if err == nil {
+		t.Fatalf("expected pruned blocks not to be served")
+	}
+
+	blocks, err := state.BlocksAfter(Hash{}, 2, 0)
+	if err != nil {
+		t.Fatalf("unable to read the full blocks. %s", err.Error())
+	}
+
+	if len(blocks) != 1 || blocks[0].Header.Number != 2 {
+		t.Fatalf("expected only block 2 after the pruned blocks, got %+v", blocks)
+	}
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DefaultSnapshotInterval is how many blocks apart the state is snapshotted
+const DefaultSnapshotInterval = 1000
+
+// Snapshot is the state as of a block, so historical state can be computed by
+// replaying blocks from the nearest snapshot instead of from the genesis
+type Snapshot struct {
+	Number   uint64                  `json:"number"`
+	Hash     Hash                    `json:"hash"`
+	Balances map[common.Address]uint `json:"balances"`
+	Nonces   map[common.Address]uint `json:"nonces"`
+}
+
+func (s *State) snapshot() Snapshot {
+	c := s.copy()
+	return Snapshot{c.lastBlock.Header.Number, c.lastBlockHash, c.Balances, c.AccountsToNonce}
+}
+
+func (s *State) restoreSnapshot(snapshot Snapshot) {
+	s.Balances = snapshot.Balances
+	s.AccountsToNonce = snapshot.Nonces
+	s.lastBlock = Block{Header: BlockHeader{Number: snapshot.Number}}
+	s.lastBlockHash = snapshot.Hash
+	s.hasGenesisBlock = true
+}
+
+// ensureSnapshot snapshots the state if its last block is due one and there
+// isn't already a snapshot of that very block
+func (s *State) ensureSnapshot() error {
+	number := s.lastBlock.Header.Number
+	if s.dataDir == "" || number == 0 || number%s.snapshotInterval != 0 {
+		return nil
+	}
+
+	existing, err := loadSnapshot(getSnapshotFilePath(s.dataDir, number))
+	if err == nil && existing.Hash == s.lastBlockHash {
+		return nil
+	}
+
+	return saveSnapshot(s.dataDir, s.snapshot())
+}
+
+func saveSnapshot(dataDir string, snapshot Snapshot) error {
+	err := os.MkdirAll(getSnapshotsDirPath(dataDir), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	snapshotJson, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	// Written aside then renamed, so a snapshot is never read half written
+	path := getSnapshotFilePath(dataDir, snapshot.Number)
+	err = ioutil.WriteFile(path+".tmp", snapshotJson, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func loadSnapshot(path string) (Snapshot, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	var snapshot Snapshot
+	err = json.Unmarshal(content, &snapshot)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("unable to decode snapshot '%s'. %s", path, err.Error())
+	}
+
+	if snapshot.Balances == nil {
+		snapshot.Balances = make(map[common.Address]uint)
+	}
+
+	if snapshot.Nonces == nil {
+		snapshot.Nonces = make(map[common.Address]uint)
+	}
+
+	return snapshot, nil
+}
+
+// loadNearestSnapshot loads the snapshot of the highest block at or below the
+// given height, if there is one
+func loadNearestSnapshot(dataDir string, height uint64) (Snapshot, bool, error) {
+	numbers, err := listSnapshots(dataDir)
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+
+	for i := len(numbers) - 1; i >= 0; i-- {
+		if numbers[i] > height {
+			continue
+		}
+
+		snapshot, err := loadSnapshot(getSnapshotFilePath(dataDir, numbers[i]))
+		if err != nil {
+			return Snapshot{}, false, err
+		}
+
+		return snapshot, true, nil
+	}
+
+	return Snapshot{}, false, nil
+}
+
+// removeSnapshotsAbove removes the snapshots of blocks above the given height,
+// which no longer are part of the chain once it's truncated
+func removeSnapshotsAbove(dataDir string, height uint64) error {
+	numbers, err := listSnapshots(dataDir)
+	if err != nil {
+		return err
+	}
+
+	for _, number := range numbers {
+		if number <= height {
+			continue
+		}
+
+		err = os.Remove(getSnapshotFilePath(dataDir, number))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listSnapshots returns the block numbers of the snapshots in ascending order
+func listSnapshots(dataDir string) ([]uint64, error) {
+	files, err := ioutil.ReadDir(getSnapshotsDirPath(dataDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := make([]uint64, 0, len(files))
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+
+		number, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		numbers = append(numbers, number)
+	}
+
+	// ReadDir sorts by name, which the zero padding makes numeric order
+	return numbers, nil
+}
+
+func getSnapshotsDirPath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "snapshots")
+}
+
+func getSnapshotFilePath(dataDir string, number uint64) string {
+	return filepath.Join(getSnapshotsDirPath(dataDir), fmt.Sprintf("%020d.json", number))
+}
@@ -2,13 +2,19 @@ package database
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"reflect"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/jTanG0506/go-blockchain/metrics"
 )
 
 const TxGasFee = uint(50)
@@ -21,41 +27,78 @@ type State struct {
 	lastBlock       Block
 	lastBlockHash   Hash
 	hasGenesisBlock bool
+
+	canonicalEncodingFork uint64
+
+	logger log.Logger
+
+	blockValidationTime *metrics.Histogram
+
+	dataDir          string
+	snapshotInterval uint64
+	archive          *archive
+
+	dbMu      *sync.Mutex
+	index     *blockIndex
+	pruneKeep uint64
+	pruned    bool
+	prunedTo  uint64
 }
 
 func NewStateFromDisk(dataDir string) (*State, error) {
-	err := InitDataDirIfNotExists(dataDir, []byte(genesisJson))
-	if err != nil {
-		return nil, err
+	return newStateFromDisk(dataDir, false)
+}
+
+// NewArchiveStateFromDisk loads the state in archive mode, keeping the state
+// diff of every block so AccountAt answers straight from them
+func NewArchiveStateFromDisk(dataDir string) (*State, error) {
+	return newStateFromDisk(dataDir, true)
+}
+
+func newStateFromDisk(dataDir string, archived bool) (*State, error) {
+	if !IsDataDirInitialised(dataDir) {
+		return nil, fmt.Errorf("data dir '%s' isn't initialised, create its genesis with 'tbs init' or run with --dev", dataDir)
 	}
 
-	gen, err := loadGenesis(getGenesisJsonFilePath(dataDir))
+	gen, err := LoadDataDirGenesis(dataDir)
 	if err != nil {
 		return nil, err
 	}
 
-	balances := make(map[common.Address]uint)
-	for account, balance := range gen.Balances {
-		balances[account] = balance
-	}
-
-	accountToNonce := make(map[common.Address]uint)
 	blocksFilePath := getBlocksDbFilePath(dataDir)
 	blocks, err := os.OpenFile(blocksFilePath, os.O_APPEND|os.O_RDWR, 0600)
 	if err != nil {
 		return nil, err
 	}
 
-	scanner := bufio.NewScanner(blocks)
-	state := &State{balances, accountToNonce, blocks, Block{}, Hash{}, false}
+	state := newStateFromGenesis(dataDir, gen, blocks)
+	err = state.restorePruneSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	if archived && state.pruned {
+		return nil, fmt.Errorf("blocks DB is pruned up to block %d, archive mode needs every block", state.prunedTo)
+	}
+	prunedHash := state.lastBlockHash
 
-	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
+	if archived {
+		state.archive, err = openArchive(dataDir, gen)
+		if err != nil {
 			return nil, err
 		}
+	}
 
-		blockFsJson := scanner.Bytes()
+	reader := bufio.NewReader(blocks)
+	offset := int64(0)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		isTerminated := err == nil
 
+		blockFsJson := bytes.TrimSpace(line)
 		if len(blockFsJson) == 0 {
 			break
 		}
@@ -63,22 +106,114 @@ func NewStateFromDisk(dataDir string) (*State, error) {
 		var blockFs BlockFS
 		err = json.Unmarshal(blockFsJson, &blockFs)
 		if err != nil {
-			return nil, err
+			// Every record is written with its newline in one go, so only an
+			// interrupted write leaves a record without one at the end of the
+			// file. Anything else is corruption which must not be discarded.
+			if isTerminated {
+				return nil, fmt.Errorf("invalid block record at offset %d of '%s'. %s", offset, blocksFilePath, err.Error())
+			}
+
+			state.logger.Warn("Truncating partially written block record", "file", blocksFilePath, "offset", offset, "bytes", len(line))
+			err = blocks.Truncate(offset)
+			if err != nil {
+				return nil, err
+			}
+
+			break
 		}
 
-		err = applyBlock(blockFs.Value, state)
-		if err != nil {
-			return nil, err
+		// The state of pruned blocks comes from the snapshot
+		number := blockFs.Value.Header.Number
+		if state.isPruned(number) {
+			if number == state.prunedTo && blockFs.Key != prunedHash {
+				return nil, fmt.Errorf("block %d in '%s' is %s, not %s of the snapshot it was pruned to", number, blocksFilePath, blockFs.Key.Hex(), prunedHash.Hex())
+			}
+		} else {
+			err = applyBlock(blockFs.Value, state)
+			if err != nil {
+				return nil, fmt.Errorf("invalid block %d in '%s', inspect it with 'tbs db verify'. %s", number, blocksFilePath, err.Error())
+			}
 		}
 
 		state.lastBlock = blockFs.Value
 		state.lastBlockHash = blockFs.Key
 		state.hasGenesisBlock = true
+		state.index.add(blockFs.Key, offset, int64(len(line)))
+		offset += int64(len(line))
+
+		if state.archive != nil {
+			err = state.archive.replayed(NewStateDiff(blockFs.Value, blockFs.Key, state))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !state.isPruned(number) {
+			err = state.ensureSnapshot()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !isTerminated {
+			state.logger.Warn("Terminating block record written without its newline", "file", blocksFilePath, "number", blockFs.Value.Header.Number)
+			err = state.persist([]byte("\n"))
+			if err != nil {
+				return nil, err
+			}
+
+			break
+		}
+	}
+
+	if state.pruned && state.lastBlock.Header.Number < state.prunedTo {
+		return nil, fmt.Errorf("blocks DB is pruned up to block %d but ends at block %d", state.prunedTo, state.lastBlock.Header.Number)
+	}
+
+	if state.archive != nil {
+		err = state.archive.loaded()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return state, nil
 }
 
+func newStateFromGenesis(dataDir string, gen Genesis, dbFile *os.File) *State {
+	balances := make(map[common.Address]uint)
+	for account, balance := range gen.Balances {
+		balances[account] = balance
+	}
+
+	accountToNonce := make(map[common.Address]uint)
+
+	return &State{
+		Balances:              balances,
+		AccountsToNonce:       accountToNonce,
+		dbFile:                dbFile,
+		dbMu:                  &sync.Mutex{},
+		index:                 newBlockIndex(),
+		canonicalEncodingFork: gen.canonicalEncodingFork(),
+		logger:                log.Root().New("component", "db"),
+		blockValidationTime:   metrics.NewHistogram(metrics.DefaultBuckets),
+		dataDir:               dataDir,
+		snapshotInterval:      DefaultSnapshotInterval,
+	}
+}
+
+// SetLogger replaces the state's logger, which logs through the root logger
+// by default
+func (s *State) SetLogger(logger log.Logger) {
+	s.logger = logger
+}
+
+// BlockValidationTime tracks how long validating blocks added to the state
+// takes, whether they turned out to be valid or not
+func (s *State) BlockValidationTime() *metrics.Histogram {
+	return s.blockValidationTime
+}
+
 func (s *State) NextBlockNumber() uint64 {
 	if !s.hasGenesisBlock {
 		return uint64(0)
@@ -95,6 +230,16 @@ func (s *State) LatestBlockHash() Hash {
 	return s.lastBlockHash
 }
 
+// BlockEncodingVersion is the encoding a block with the given number must be
+// hashed with
+func (s *State) BlockEncodingVersion(number uint64) uint8 {
+	if number >= s.canonicalEncodingFork {
+		return EncodingVersionCanonical
+	}
+
+	return EncodingVersionJSON
+}
+
 func (s *State) AddBlocks(blocks []Block) error {
 	for _, b := range blocks {
 		_, err := s.AddBlock(b)
@@ -109,7 +254,9 @@ func (s *State) AddBlocks(blocks []Block) error {
 func (s *State) AddBlock(b Block) (Hash, error) {
 	tempState := s.copy()
 
+	start := time.Now()
 	err := applyBlock(b, &tempState)
+	s.blockValidationTime.ObserveDuration(time.Since(start))
 	if err != nil {
 		return Hash{}, err
 	}
@@ -126,10 +273,9 @@ func (s *State) AddBlock(b Block) (Hash, error) {
 		return Hash{}, err
 	}
 
-	fmt.Printf("Persisting new block to disk:\n")
-	fmt.Printf("%s\n", blockFsJson)
+	s.logger.Debug("Persisting new block to disk", "number", b.Header.Number, "hash", blockHash.Hex(), "txs", len(b.TXs))
 
-	_, err = s.dbFile.Write(append(blockFsJson, '\n'))
+	err = s.persistBlock(blockHash, append(blockFsJson, '\n'))
 	if err != nil {
 		return Hash{}, err
 	}
@@ -140,6 +286,8 @@ func (s *State) AddBlock(b Block) (Hash, error) {
 	s.lastBlock = b
 	s.hasGenesisBlock = true
 
+	s.recordHistory(b, blockHash)
+
 	return blockHash, nil
 }
 
@@ -147,11 +295,16 @@ func applyBlock(b Block, s *State) error {
 	expectedNextBlockNumber := s.lastBlock.Header.Number + 1
 
 	if s.hasGenesisBlock && b.Header.Number != expectedNextBlockNumber {
-		return fmt.Errorf("next expected block must have number '%d' not '%d'", expectedNextBlockNumber, b.Header.Number)
+		return newBlockErr(BlockErrNumber, "next expected block must have number '%d' not '%d'", expectedNextBlockNumber, b.Header.Number)
 	}
 
 	if s.hasGenesisBlock && s.lastBlock.Header.Number > 0 && !reflect.DeepEqual(b.Header.Parent, s.lastBlockHash) {
-		return fmt.Errorf("next block parent hash must be '%x' not '%x'", s.lastBlockHash, b.Header.Parent)
+		return newBlockErr(BlockErrParent, "next block parent hash must be '%x' not '%x'", s.lastBlockHash, b.Header.Parent)
+	}
+
+	expectedVersion := s.BlockEncodingVersion(b.Header.Number)
+	if b.Header.Version != expectedVersion {
+		return newBlockErr(BlockErrEncoding, "block '%d' must use encoding version %d not %d", b.Header.Number, expectedVersion, b.Header.Version)
 	}
 
 	hash, err := b.Hash()
@@ -160,7 +313,7 @@ func applyBlock(b Block, s *State) error {
 	}
 
 	if !IsBlockHashValid(hash) {
-		return fmt.Errorf("invalid block hash %x", hash)
+		return newBlockErr(BlockErrPoW, "invalid block hash %x", hash)
 	}
 
 	err = applyTXs(b.TXs, s)
@@ -173,8 +326,12 @@ func applyBlock(b Block, s *State) error {
 	return nil
 }
 
-func applyTXs(txs []SignedTx, s *State) error {
-	sort.Slice(txs, func(i, j int) bool {
+func applyTXs(blockTXs []SignedTx, s *State) error {
+	// Sort a copy, the order of the block's own TXs is part of its hash
+	txs := make([]SignedTx, len(blockTXs))
+	copy(txs, blockTXs)
+
+	sort.SliceStable(txs, func(i, j int) bool {
 		return txs[i].Time < txs[j].Time
 	})
 
@@ -191,21 +348,21 @@ func applyTXs(txs []SignedTx, s *State) error {
 func applyTx(tx SignedTx, s *State) error {
 	ok, err := tx.IsSigAuthentic()
 	if err != nil {
-		return err
+		return newBlockErr(BlockErrTxSignature, "%s", err.Error())
 	}
 
 	if !ok {
-		return fmt.Errorf("wrong Tx, sender '%s' is forged", tx.From.String())
+		return newBlockErr(BlockErrTxSignature, "wrong Tx, sender '%s' is forged", tx.From.String())
 	}
 
 	expectedNonce := s.GetNextAccountNonce(tx.From)
 	if tx.Nonce != expectedNonce {
-		fmt.Errorf("wrong Tx, sender '%s' next nonce must be '%d', not '%d'", tx.From.String(), expectedNonce, tx.Nonce)
+		return newBlockErr(BlockErrTxNonce, "wrong Tx, sender '%s' next nonce must be '%d', not '%d'", tx.From.String(), expectedNonce, tx.Nonce)
 	}
 
 	txCost := tx.Value + TxGasFee
 	if txCost > s.Balances[tx.From] {
-		return fmt.Errorf("insufficient balance. Sender '%s' balance is %d TBS. Tx cost is %d TBS", tx.From.String(), s.Balances[tx.From], txCost)
+		return newBlockErr(BlockErrInsufficientBalance, "insufficient balance. Sender '%s' balance is %d TBS. Tx cost is %d TBS", tx.From.String(), s.Balances[tx.From], txCost)
 	}
 
 	s.Balances[tx.From] -= txCost
@@ -222,6 +379,8 @@ func (s *State) copy() State {
 	c.lastBlock = s.lastBlock
 	c.lastBlockHash = s.lastBlockHash
 	c.hasGenesisBlock = s.hasGenesisBlock
+	c.canonicalEncodingFork = s.canonicalEncodingFork
+	c.logger = s.logger
 
 	for acc, balance := range s.Balances {
 		c.Balances[acc] = balance
@@ -234,10 +393,74 @@ func (s *State) copy() State {
 	return c
 }
 
+func (s *State) persist(data []byte) error {
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	_, err := s.write(data)
+	return err
+}
+
+// persistBlock appends the record of a block and indexes where it was written
+func (s *State) persistBlock(hash Hash, data []byte) error {
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	offset, err := s.write(data)
+	if err != nil {
+		return err
+	}
+
+	s.index.add(hash, offset, int64(len(data)))
+	return nil
+}
+
+// write appends to the blocks DB and only returns once the data reached the
+// disk, so a block is never reported added before it survives a crash. It
+// returns the offset the data was written at, dbMu must be held.
+func (s *State) write(data []byte) (int64, error) {
+	offset, err := s.dbFile.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = s.dbFile.Write(data)
+	if err != nil {
+		return 0, err
+	}
+
+	return offset, s.dbFile.Sync()
+}
+
 func (s *State) GetNextAccountNonce(account common.Address) uint {
 	return s.AccountsToNonce[account] + 1
 }
 
+// recordHistory archives the state diff of a block just added and snapshots
+// the state when it's due. The block is already persisted, so failing here
+// only loses history which is rebuilt on the next start.
+func (s *State) recordHistory(b Block, hash Hash) {
+	if s.archive != nil {
+		err := s.archive.append(NewStateDiff(b, hash, s))
+		if err != nil {
+			s.logger.Error("Failed to archive state diff", "number", b.Header.Number, "err", err)
+		}
+	}
+
+	err := s.ensureSnapshot()
+	if err != nil {
+		s.logger.Error("Failed to snapshot state", "number", b.Header.Number, "err", err)
+	}
+
+	err = s.Prune()
+	if err != nil {
+		s.logger.Error("Failed to prune block bodies", "number", b.Header.Number, "err", err)
+	}
+}
+
 func (s *State) Close() {
 	s.dbFile.Close()
+	if s.archive != nil {
+		s.archive.close()
+	}
 }
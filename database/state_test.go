@@ -0,0 +1,123 @@
+package database
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestNewStateFromDiskTruncatesPartialRecord(t *testing.T) {
+	dataDir := setupTestDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	err := ioutil.WriteFile(getBlocksDbFilePath(dataDir), []byte(`{"hash":"0000a1","block":{"header":{"par`), 0600)
+	if err != nil {
+		t.Fatalf("unable to write partial record. %s", err.Error())
+	}
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("expected partial trailing record to be truncated, got: %s", err.Error())
+	}
+	state.Close()
+
+	content, err := ioutil.ReadFile(getBlocksDbFilePath(dataDir))
+	if err != nil {
+		t.Fatalf("unable to read blocks DB. %s", err.Error())
+	}
+
+	if len(content) != 0 {
+		t.Fatalf("expected blocks DB to be truncated, still contains %q", content)
+	}
+}
+
+func TestNewStateFromDiskRejectsCorruptRecord(t *testing.T) {
+	dataDir := setupTestDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	corrupt := []byte("{\"hash\":\"0000a1\",\"block\":{\"header\":{\"par\n")
+	err := ioutil.WriteFile(getBlocksDbFilePath(dataDir), corrupt, 0600)
+	if err != nil {
+		t.Fatalf("unable to write corrupt record. %s", err.Error())
+	}
+
+	_, err = NewStateFromDisk(dataDir)
+	if err == nil {
+		t.Fatalf("expected a complete but invalid record to be rejected rather than truncated")
+	}
+}
+
+func TestApplyTxRejectsWrongNonce(t *testing.T) {
+	dataDir := setupTestDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+	defer state.Close()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	state.Balances[from] = 1000
+
+	for _, nonce := range []uint{2, 0} {
+		err = applyTx(signTestTx(t, NewTx(from, common.HexToAddress("0x02"), 10, nonce, ""), key), state)
+		if blockErr, ok := err.(*BlockErr); !ok || blockErr.Reason != BlockErrTxNonce {
+			t.Fatalf("expected TX with nonce %d to be rejected for its nonce, got %v", nonce, err)
+		}
+	}
+
+	if state.Balances[from] != 1000 {
+		t.Fatalf("expected rejected TXs to leave the balance untouched, got %d", state.Balances[from])
+	}
+
+	tx := signTestTx(t, NewTx(from, common.HexToAddress("0x02"), 10, 1, ""), key)
+	err = applyTx(tx, state)
+	if err != nil {
+		t.Fatalf("unable to apply TX with the next nonce. %s", err.Error())
+	}
+
+	err = applyTx(tx, state)
+	if blockErr, ok := err.(*BlockErr); !ok || blockErr.Reason != BlockErrTxNonce {
+		t.Fatalf("expected replayed TX to be rejected for its nonce, got %v", err)
+	}
+}
+
+func signTestTx(t *testing.T, tx Tx, key *ecdsa.PrivateKey) SignedTx {
+	rawTx, err := tx.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txHash := sha256.Sum256(rawTx)
+	sig, err := crypto.Sign(txHash[:], key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSignedTx(tx, sig)
+}
+
+func setupTestDataDir(t *testing.T) string {
+	dataDir, err := ioutil.TempDir("", "tbs_state_test")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory. %s", err.Error())
+	}
+
+	genesis := NewGenesis("test", map[common.Address]uint{common.HexToAddress("0x01"): 1000})
+	err = InitDataDir(dataDir, genesis)
+	if err != nil {
+		t.Fatalf("unable to initialise data dir. %s", err.Error())
+	}
+
+	return dataDir
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/elliptic"
 	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -21,19 +22,30 @@ type Tx struct {
 	Nonce uint           `json:"nonce"`
 	Data  string         `json:"data"`
 	Time  uint64         `json:"time"`
+	// Version selects the encoding the TX is hashed and signed over. It's
+	// omitted from JSON when 0 so legacy TXs keep their original hash.
+	Version uint8 `json:"version,omitempty"`
 }
 
 type SignedTx struct {
 	Tx
 	Sig []byte `json:"signature"`
+	// Multisig and Sigs authorise TXs sent from a multisig account, in which
+	// case Sig is left empty
+	Multisig *Multisig `json:"multisig,omitempty"`
+	Sigs     [][]byte  `json:"signatures,omitempty"`
 }
 
 func NewTx(from common.Address, to common.Address, value, nonce uint, data string) Tx {
-	return Tx{from, to, value, nonce, data, uint64(time.Now().Unix())}
+	return Tx{from, to, value, nonce, data, uint64(time.Now().Unix()), EncodingVersionCanonical}
 }
 
 func NewSignedTx(tx Tx, sig []byte) SignedTx {
-	return SignedTx{tx, sig}
+	return SignedTx{Tx: tx, Sig: sig}
+}
+
+func NewMultisigSignedTx(tx Tx, multisig Multisig, sigs [][]byte) SignedTx {
+	return SignedTx{Tx: tx, Multisig: &multisig, Sigs: sigs}
 }
 
 func (t Tx) IsReward() bool {
@@ -50,7 +62,14 @@ func (t Tx) Hash() (Hash, error) {
 }
 
 func (t Tx) Encode() ([]byte, error) {
-	return json.Marshal(t)
+	switch t.Version {
+	case EncodingVersionJSON:
+		return json.Marshal(t)
+	case EncodingVersionCanonical:
+		return encodeCanonicalTx(t)
+	default:
+		return nil, fmt.Errorf("unknown TX encoding version %d", t.Version)
+	}
 }
 
 func (t SignedTx) Hash() (Hash, error) {
@@ -62,24 +81,47 @@ func (t SignedTx) Hash() (Hash, error) {
 	return sha256.Sum256(txJson), nil
 }
 
+func (t SignedTx) Encode() ([]byte, error) {
+	switch t.Version {
+	case EncodingVersionJSON:
+		return json.Marshal(t)
+	case EncodingVersionCanonical:
+		return encodeCanonicalSignedTx(t)
+	default:
+		return nil, fmt.Errorf("unknown TX encoding version %d", t.Version)
+	}
+}
+
 func (t SignedTx) IsSigAuthentic() (bool, error) {
 	txHash, err := t.Tx.Hash()
 	if err != nil {
 		return false, err
 	}
 
-	recoveredPubKey, err := crypto.SigToPub(txHash[:], t.Sig)
+	if t.Multisig != nil {
+		return t.Multisig.isAuthentic(t.From, txHash, t.Sigs)
+	}
+
+	recoveredAccount, err := recoverSigner(txHash, t.Sig)
 	if err != nil {
 		return false, err
 	}
 
+	return recoveredAccount.Hex() == t.From.Hex(), nil
+}
+
+func recoverSigner(txHash Hash, sig []byte) (common.Address, error) {
+	recoveredPubKey, err := crypto.SigToPub(txHash[:], sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+
 	recoveredPubKeyBytes := elliptic.Marshal(
 		crypto.S256(),
 		recoveredPubKey.X,
 		recoveredPubKey.Y,
 	)
 	recoveredPubKeyBytesHash := crypto.Keccak256(recoveredPubKeyBytes[1:])
-	recoveredAccount := common.BytesToAddress(recoveredPubKeyBytesHash[12:])
 
-	return recoveredAccount.Hex() == t.From.Hex(), nil
+	return common.BytesToAddress(recoveredPubKeyBytesHash[12:]), nil
 }
@@ -0,0 +1,267 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// BlockErrReason tells which rule a block broke
+type BlockErrReason string
+
+const (
+	BlockErrDecode              BlockErrReason = "decode"
+	BlockErrHash                BlockErrReason = "hash"
+	BlockErrNumber              BlockErrReason = "number"
+	BlockErrParent              BlockErrReason = "parent"
+	BlockErrEncoding            BlockErrReason = "encoding"
+	BlockErrPoW                 BlockErrReason = "pow"
+	BlockErrTxSignature         BlockErrReason = "tx_signature"
+	BlockErrTxNonce             BlockErrReason = "tx_nonce"
+	BlockErrInsufficientBalance BlockErrReason = "insufficient_balance"
+)
+
+// BlockErr is returned when a block, or one of its TXs, is invalid
+type BlockErr struct {
+	Reason BlockErrReason
+	msg    string
+}
+
+func newBlockErr(reason BlockErrReason, format string, args ...interface{}) *BlockErr {
+	return &BlockErr{Reason: reason, msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *BlockErr) Error() string {
+	return e.msg
+}
+
+// BadBlock is the first block of a chain which failed verification
+type BadBlock struct {
+	Number uint64
+	Hash   Hash
+	// Offset is where the block's record starts in the blocks DB
+	Offset int64
+	Reason BlockErrReason
+	Err    error
+}
+
+// ChainReport describes the valid prefix of the chain in a data dir, and the
+// block it ends at if that isn't the end of the blocks DB
+type ChainReport struct {
+	Blocks   uint64
+	Height   uint64
+	LastHash Hash
+	BadBlock *BadBlock
+
+	// end is the offset right after the last valid block's record
+	end int64
+	// firstAbove is set when the chain's first block is above the height
+	// replayed to, so no block is kept
+	firstAbove bool
+}
+
+// VerifyDataDir streams the blocks DB and replays every block on top of the
+// genesis, or of the snapshot the blocks DB was pruned to, stopping at the
+// first block which isn't valid. Nothing is written.
+func VerifyDataDir(dataDir string) (ChainReport, error) {
+	return verifyBlocks(dataDir, math.MaxUint64)
+}
+
+// TruncateDataDir cuts the blocks DB right after the block with the given
+// height, along with the snapshots of the blocks removed. Every block kept
+// must be valid, so the node can carry on syncing from there. A height below
+// the chain's first block empties the blocks DB. The node must not be
+// running.
+func TruncateDataDir(dataDir string, height uint64) (ChainReport, error) {
+	state, report, err := replayBlocks(dataDir, height)
+	if err != nil {
+		return ChainReport{}, err
+	}
+
+	if state.isPruned(height) && height < state.prunedTo {
+		return report, fmt.Errorf("unable to truncate to height %d, the blocks up to %d are pruned", height, state.prunedTo)
+	}
+
+	tooShort := !state.hasGenesisBlock || state.lastBlock.Header.Number < height
+	if tooShort && !report.firstAbove {
+		if report.BadBlock != nil {
+			return report, fmt.Errorf("unable to truncate to height %d, block %d is invalid. %s", height, report.BadBlock.Number, report.BadBlock.Err.Error())
+		}
+
+		if !state.hasGenesisBlock {
+			return report, fmt.Errorf("unable to truncate to height %d, the chain has no blocks", height)
+		}
+
+		return report, fmt.Errorf("unable to truncate to height %d, the chain height is %d", height, state.lastBlock.Header.Number)
+	}
+
+	blocks, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_RDWR, 0600)
+	if err != nil {
+		return ChainReport{}, err
+	}
+	defer blocks.Close()
+
+	err = blocks.Truncate(report.end)
+	if err != nil {
+		return ChainReport{}, err
+	}
+
+	err = blocks.Sync()
+	if err != nil {
+		return ChainReport{}, err
+	}
+
+	return report, removeSnapshotsAbove(dataDir, height)
+}
+
+func verifyBlocks(dataDir string, maxHeight uint64) (ChainReport, error) {
+	_, report, err := replayBlocks(dataDir, maxHeight)
+	return report, err
+}
+
+// replayBlocks rebuilds the state of the chain in the data dir up to the
+// block with the given height, or up to its first invalid block. The state
+// returned has no blocks DB to write to.
+func replayBlocks(dataDir string, maxHeight uint64) (*State, ChainReport, error) {
+	if !IsDataDirInitialised(dataDir) {
+		return nil, ChainReport{}, fmt.Errorf("data dir '%s' isn't initialised", dataDir)
+	}
+
+	gen, err := LoadDataDirGenesis(dataDir)
+	if err != nil {
+		return nil, ChainReport{}, err
+	}
+
+	state := newStateFromGenesis(dataDir, gen, nil)
+	err = state.restorePruneSnapshot()
+	if err != nil {
+		return nil, ChainReport{}, err
+	}
+
+	report, err := replayBlocksOnto(state, maxHeight)
+	if err != nil {
+		return nil, ChainReport{}, err
+	}
+
+	return state, report, nil
+}
+
+// replayBlocksOnto applies the blocks following the state's last block, which
+// must be part of the chain, up to the block with the given height
+func replayBlocksOnto(state *State, maxHeight uint64) (ChainReport, error) {
+	blocks, err := os.Open(getBlocksDbFilePath(state.dataDir))
+	if err != nil {
+		return ChainReport{}, err
+	}
+	defer blocks.Close()
+
+	report := ChainReport{}
+	base := state.lastBlock.Header.Number
+	baseFound := !state.hasGenesisBlock
+
+	reader := bufio.NewReader(blocks)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return ChainReport{}, err
+		}
+
+		blockFsJson := bytes.TrimSpace(line)
+		if len(blockFsJson) == 0 {
+			break
+		}
+
+		var blockFs BlockFS
+		err = json.Unmarshal(blockFsJson, &blockFs)
+		if err != nil {
+			report.BadBlock = &BadBlock{Number: state.NextBlockNumber(), Offset: report.end, Reason: BlockErrDecode, Err: err}
+			break
+		}
+
+		if !baseFound {
+			report.end += int64(len(line))
+			if blockFs.Value.Header.Number == base {
+				if blockFs.Key != state.lastBlockHash {
+					return ChainReport{}, fmt.Errorf("block %d is %s, not %s the replay started from", base, blockFs.Key.Hex(), state.lastBlockHash.Hex())
+				}
+
+				baseFound = true
+			}
+
+			continue
+		}
+
+		// Chains mined from scratch start at block 1
+		if !state.hasGenesisBlock && blockFs.Value.Header.Number > maxHeight {
+			report.firstAbove = true
+			break
+		}
+
+		if blockFs.Pruned {
+			return ChainReport{}, fmt.Errorf("block %d is pruned, its TXs are no longer available", blockFs.Value.Header.Number)
+		}
+
+		bad := verifyBlock(blockFs, state)
+		if bad != nil {
+			bad.Offset = report.end
+			report.BadBlock = bad
+			break
+		}
+
+		report.Blocks++
+		report.Height = state.lastBlock.Header.Number
+		report.LastHash = state.lastBlockHash
+		report.end += int64(len(line))
+
+		if report.Height >= maxHeight {
+			break
+		}
+	}
+
+	if !baseFound {
+		return ChainReport{}, fmt.Errorf("block %d the replay started from isn't in the chain", base)
+	}
+
+	return report, nil
+}
+
+// verifyBlock applies the block of a blocks DB record to the state, returning
+// what's wrong with it if it's invalid
+func verifyBlock(blockFs BlockFS, state *State) *BadBlock {
+	b := blockFs.Value
+	bad := &BadBlock{Number: b.Header.Number, Hash: blockFs.Key}
+
+	hash, err := b.Hash()
+	if err != nil {
+		bad.Reason, bad.Err = BlockErrDecode, err
+		return bad
+	}
+
+	if hash != blockFs.Key {
+		bad.Reason, bad.Err = BlockErrHash, fmt.Errorf("block hashes to '%s' not '%s'", hash.Hex(), blockFs.Key.Hex())
+		return bad
+	}
+
+	err = applyBlock(b, state)
+	if err != nil {
+		var blockErr *BlockErr
+		if !errors.As(err, &blockErr) {
+			bad.Reason, bad.Err = BlockErrDecode, err
+			return bad
+		}
+
+		bad.Reason, bad.Err = blockErr.Reason, err
+		return bad
+	}
+
+	state.lastBlock = b
+	state.lastBlockHash = hash
+	state.hasGenesisBlock = true
+
+	return nil
+}
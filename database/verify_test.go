@@ -0,0 +1,156 @@
+package database
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestVerifyDataDirReportsFirstBadBlock(t *testing.T) {
+	dataDir := setupTestDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	addTestChain(t, dataDir)
+
+	report, err := VerifyDataDir(dataDir)
+	if err != nil {
+		t.Fatalf("unable to verify data dir. %s", err.Error())
+	}
+
+	if report.BadBlock == nil {
+		t.Fatalf("expected block 2 to be reported as bad")
+	}
+
+	if report.BadBlock.Number != 2 || report.BadBlock.Reason != BlockErrNumber {
+		t.Fatalf("expected block 2 to have a bad number, got block %d with reason '%s'", report.BadBlock.Number, report.BadBlock.Reason)
+	}
+
+	if report.Blocks != 1 || report.Height != 0 {
+		t.Fatalf("expected 1 valid block up to height 0, got %d blocks up to height %d", report.Blocks, report.Height)
+	}
+}
+
+func TestTruncateDataDir(t *testing.T) {
+	dataDir := setupTestDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	addTestChain(t, dataDir)
+
+	_, err := TruncateDataDir(dataDir, 1)
+	if err == nil {
+		t.Fatalf("expected truncating to a height including the bad block to fail")
+	}
+
+	_, err = TruncateDataDir(dataDir, 0)
+	if err != nil {
+		t.Fatalf("unable to truncate data dir. %s", err.Error())
+	}
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load truncated state. %s", err.Error())
+	}
+	defer state.Close()
+
+	if state.LastBlock().Header.Number != 0 || state.NextBlockNumber() != 1 {
+		t.Fatalf("expected chain to end at block 0, ends at block %d", state.LastBlock().Header.Number)
+	}
+}
+
+func TestTruncateDataDirBelowFirstBlock(t *testing.T) {
+	dataDir := setupTestDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+
+	// Numbered from 1 like the chain of a node mining from scratch
+	b := mineTestBlock(t, NewBlock(state.LatestBlockHash(), 1, 0, uint64(time.Now().Unix()), common.HexToAddress("0x02"), []SignedTx{}))
+	_, err = state.AddBlock(b)
+	if err != nil {
+		t.Fatalf("unable to add block 1. %s", err.Error())
+	}
+	addTestBlocks(t, state, 1)
+	state.Close()
+
+	report, err := TruncateDataDir(dataDir, 0)
+	if err != nil {
+		t.Fatalf("unable to truncate data dir below its first block. %s", err.Error())
+	}
+
+	if report.Blocks != 0 {
+		t.Fatalf("expected no block to be kept, got %d", report.Blocks)
+	}
+
+	state, err = NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load truncated state. %s", err.Error())
+	}
+	defer state.Close()
+
+	if !state.LatestBlockHash().IsEmpty() || state.NextBlockNumber() != 0 {
+		t.Fatalf("expected an empty chain, ends at block %d", state.LastBlock().Header.Number)
+	}
+
+	_, err = TruncateDataDir(dataDir, 0)
+	if err == nil {
+		t.Fatalf("expected truncating a chain without blocks to fail")
+	}
+}
+
+// addTestChain writes a valid block followed by one skipping a number
+func addTestChain(t *testing.T, dataDir string) {
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+	defer state.Close()
+
+	addTestBlocks(t, state, 1)
+
+	b := NewBlock(state.LatestBlockHash(), state.NextBlockNumber()+1, 0, uint64(time.Now().Unix()), common.HexToAddress("0x02"), []SignedTx{})
+	hash, err := b.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockFsJson, err := json.Marshal(BlockFS{Key: hash, Value: b})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = state.persist(append(blockFsJson, '\n'))
+	if err != nil {
+		t.Fatalf("unable to write bad block. %s", err.Error())
+	}
+}
+
+func addTestBlocks(t *testing.T, state *State, count int) {
+	for i := 0; i < count; i++ {
+		b := mineTestBlock(t, NewBlock(state.LatestBlockHash(), state.NextBlockNumber(), 0, uint64(time.Now().Unix()), common.HexToAddress("0x02"), []SignedTx{}))
+
+		_, err := state.AddBlock(b)
+		if err != nil {
+			t.Fatalf("unable to add block %d. %s", b.Header.Number, err.Error())
+		}
+	}
+}
+
+func mineTestBlock(t *testing.T, b Block) Block {
+	hasher, err := NewNonceHasher(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for nonce := uint32(0); ; nonce++ {
+		if IsBlockHashValid(hasher.Hash(nonce)) {
+			b.Header.Nonce = nonce
+			return b
+		}
+	}
+}
@@ -3,8 +3,11 @@ module github.com/jTanG0506/go-blockchain
 go 1.16
 
 require (
-	github.com/davecgh/go-spew v1.1.1
+	github.com/BurntSushi/toml v1.2.0
 	github.com/ethereum/go-ethereum v1.9.25
 	github.com/pborman/uuid v0.0.0-20170112150404-1b00554d8222
 	github.com/spf13/cobra v1.2.1
+	github.com/spf13/pflag v1.0.5
+	github.com/tyler-smith/go-bip39 v1.0.1-0.20181017060643-dbb3b84ba2ef
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,158 @@
+// Package metrics is a minimal implementation of the Prometheus text
+// exposition format, enough for a node to report its counters, gauges and
+// latency histograms without pulling in the Prometheus client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds, in seconds, of latency histograms
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts observations into cumulative buckets, like a Prometheus
+// histogram. It's safe for concurrent use.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func NewHistogram(buckets []float64) *Histogram {
+	sorted := make([]float64, len(buckets))
+	copy(sorted, buckets)
+	sort.Float64s(sorted)
+
+	return &Histogram{buckets: sorted, counts: make([]uint64, len(sorted))}
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += value
+	h.count++
+}
+
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+func (h *Histogram) snapshot() (buckets []float64, counts []uint64, sum float64, count uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counts = make([]uint64, len(h.counts))
+	copy(counts, h.counts)
+
+	return h.buckets, counts, h.sum, h.count
+}
+
+// Writer writes metrics in the Prometheus text format. Samples of the same
+// metric must be written one after the other, the HELP and TYPE lines are only
+// written before the first of them.
+type Writer struct {
+	w       io.Writer
+	written map[string]bool
+	err     error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, written: make(map[string]bool)}
+}
+
+// Err returns the first error encountered while writing
+func (w *Writer) Err() error {
+	return w.err
+}
+
+// Counter writes a sample of a counter, labels are given as key, value pairs
+func (w *Writer) Counter(name, help string, value float64, labels ...string) {
+	w.header(name, help, "counter")
+	w.sample(name, value, labels...)
+}
+
+// Gauge writes a sample of a gauge, labels are given as key, value pairs
+func (w *Writer) Gauge(name, help string, value float64, labels ...string) {
+	w.header(name, help, "gauge")
+	w.sample(name, value, labels...)
+}
+
+// Histogram writes the buckets, sum and count of a histogram, labels are
+// given as key, value pairs
+func (w *Writer) Histogram(name, help string, h *Histogram, labels ...string) {
+	w.header(name, help, "histogram")
+
+	buckets, counts, sum, count := h.snapshot()
+	for i, bound := range buckets {
+		w.sample(name+"_bucket", float64(counts[i]), withLabel(labels, "le", formatValue(bound))...)
+	}
+
+	w.sample(name+"_bucket", float64(count), withLabel(labels, "le", "+Inf")...)
+	w.sample(name+"_sum", sum, labels...)
+	w.sample(name+"_count", float64(count), labels...)
+}
+
+func (w *Writer) header(name, help, metricType string) {
+	if w.written[name] {
+		return
+	}
+
+	w.written[name] = true
+	w.printf("# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	w.printf("# TYPE %s %s\n", name, metricType)
+}
+
+func (w *Writer) sample(name string, value float64, labels ...string) {
+	if len(labels) == 0 {
+		w.printf("%s %s\n", name, formatValue(value))
+		return
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", labels[i], strconv.Quote(labels[i+1])))
+	}
+
+	w.printf("%s{%s} %s\n", name, strings.Join(pairs, ","), formatValue(value))
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
+
+func withLabel(labels []string, key, value string) []string {
+	return append(append(make([]string, 0, len(labels)+2), labels...), key, value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
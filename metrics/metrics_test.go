@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriterFormat(t *testing.T) {
+	h := NewHistogram([]float64{0.5, 0.1})
+	h.Observe(0.05)
+	h.Observe(0.2)
+	h.Observe(3)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Gauge("tbs_height", "Height of the chain", 42)
+	w.Counter("tbs_requests_total", "HTTP requests", 3, "route", "/node/status", "code", "200")
+	w.Counter("tbs_requests_total", "HTTP requests", 1, "route", "/tx/add", "code", "500")
+	w.Histogram("tbs_latency_seconds", "Latency", h, "route", "/node/status")
+
+	if w.Err() != nil {
+		t.Fatalf("unable to write metrics. %s", w.Err().Error())
+	}
+
+	expected := `# HELP tbs_height Height of the chain
+# TYPE tbs_height gauge
+tbs_height 42
+# HELP tbs_requests_total HTTP requests
+# TYPE tbs_requests_total counter
+tbs_requests_total{route="/node/status",code="200"} 3
+tbs_requests_total{route="/tx/add",code="500"} 1
+# HELP tbs_latency_seconds Latency
+# TYPE tbs_latency_seconds histogram
+tbs_latency_seconds_bucket{route="/node/status",le="0.1"} 1
+tbs_latency_seconds_bucket{route="/node/status",le="0.5"} 2
+tbs_latency_seconds_bucket{route="/node/status",le="+Inf"} 3
+tbs_latency_seconds_sum{route="/node/status"} 3.25
+tbs_latency_seconds_count{route="/node/status"} 3
+`
+
+	if buf.String() != expected {
+		t.Fatalf("unexpected metrics output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
@@ -0,0 +1,135 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jTanG0506/go-blockchain/database"
+)
+
+// QueryNextNonce asks the node at nodeURL, e.g. http://127.0.0.1:8080, for
+// the nonce the account's next TX must use
+func QueryNextNonce(nodeURL string, account common.Address) (uint, error) {
+	res, err := http.Get(fmt.Sprintf(
+		"%s%s?%s=%s",
+		nodeURL,
+		nonceEndpoint,
+		nonceEndpointQueryKeyAccount,
+		url.QueryEscape(account.Hex()),
+	))
+	if err != nil {
+		return 0, err
+	}
+
+	nonceRes := NonceRes{}
+	err = readNodeResponse(res, &nonceRes)
+	if err != nil {
+		return 0, err
+	}
+
+	return nonceRes.Nonce, nil
+}
+
+// BroadcastTX sends a TX signed outside of the node to the node at nodeURL to
+// be added to its pending TXs
+func BroadcastTX(nodeURL string, tx database.SignedTx) error {
+	txJson, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+
+	res, err := http.Post(nodeURL+addSignedTXEndpoint, "application/json", bytes.NewReader(txJson))
+	if err != nil {
+		return err
+	}
+
+	addTxRes := AddTXRes{}
+	err = readNodeResponse(res, &addTxRes)
+	if err != nil {
+		return err
+	}
+
+	if !addTxRes.Success {
+		return fmt.Errorf("node didn't accept the TX")
+	}
+
+	return nil
+}
+
+// RegisterWebhook registers a webhook on the node at nodeURL, the webhook
+// returned holds the secret its deliveries are signed with
+func RegisterWebhook(nodeURL string, req AddWebhookReq) (Webhook, error) {
+	reqJson, err := json.Marshal(req)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	res, err := http.Post(nodeURL+webhooksEndpoint, "application/json", bytes.NewReader(reqJson))
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	hook := Webhook{}
+	err = readNodeResponse(res, &hook)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	return hook, nil
+}
+
+// ListWebhooks returns the webhooks registered on the node at nodeURL
+func ListWebhooks(nodeURL string) ([]Webhook, error) {
+	res, err := http.Get(nodeURL + webhooksEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooksRes := WebhooksRes{}
+	err = readNodeResponse(res, &webhooksRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooksRes.Webhooks, nil
+}
+
+// RemoveWebhook removes the webhook with the given ID from the node at nodeURL
+func RemoveWebhook(nodeURL string, id string) (Webhook, error) {
+	req, err := http.NewRequest(http.MethodDelete, nodeURL+webhookEndpoint+url.PathEscape(id), nil)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	hook := Webhook{}
+	err = readNodeResponse(res, &hook)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	return hook, nil
+}
+
+// readNodeResponse reads a response, turning the node's ErrorRes into an error
+func readNodeResponse(res *http.Response, content interface{}) error {
+	if res.StatusCode != http.StatusOK {
+		errRes := ErrorRes{}
+		err := readResponse(res, &errRes)
+		if err != nil {
+			return fmt.Errorf("node responded with status %d", res.StatusCode)
+		}
+
+		return fmt.Errorf(errRes.Error)
+	}
+
+	return readResponse(res, content)
+}
@@ -0,0 +1,477 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jTanG0506/go-blockchain/database"
+)
+
+const eventsKeepAliveInterval = 15 * time.Second
+
+// eventsSubscriptionBuffer is how many events a subscription may lag behind
+// before it's dropped, the client then resumes from its last event ID
+const eventsSubscriptionBuffer = 256
+
+type EventType string
+
+const (
+	EventBlock          EventType = "block"
+	EventPendingTX      EventType = "pending_tx"
+	EventTXConfirmation EventType = "tx_confirmation"
+	EventBalance        EventType = "balance"
+)
+
+const eventsTopicBlocks = "blocks"
+const eventsTopicPendingTXs = "pending_txs"
+
+type BlockEvent struct {
+	Hash  database.Hash  `json:"block_hash"`
+	Block database.Block `json:"block"`
+}
+
+type PendingTXEvent struct {
+	Hash database.Hash     `json:"tx_hash"`
+	TX   database.SignedTx `json:"tx"`
+}
+
+type TXConfirmationEvent struct {
+	TXHash        database.Hash `json:"tx_hash"`
+	BlockHash     database.Hash `json:"block_hash"`
+	Number        uint64        `json:"block_number"`
+	Confirmations uint64        `json:"confirmations"`
+}
+
+type Event struct {
+	Type EventType
+	Data interface{}
+}
+
+// addedBlock is a block added to the chain along with the state, after it,
+// of the accounts it touched
+type addedBlock struct {
+	hash  database.Hash
+	block database.Block
+	diff  database.StateDiff
+}
+
+// hubEvent is either a block added to the chain or a new pending TX
+type hubEvent struct {
+	block *addedBlock
+	tx    *database.SignedTx
+}
+
+type subscription struct {
+	events chan hubEvent
+}
+
+// eventHub fans out the blocks added to the chain and the new pending TXs to
+// every subscription. A subscription too slow to keep up is dropped rather
+// than blocking the node.
+type eventHub struct {
+	mu     sync.Mutex
+	subs   map[*subscription]struct{}
+	closed bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[*subscription]struct{})}
+}
+
+func (h *eventHub) subscribe() (*subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, fmt.Errorf("node is shutting down")
+	}
+
+	sub := &subscription{make(chan hubEvent, eventsSubscriptionBuffer)}
+	h.subs[sub] = struct{}{}
+
+	return sub, nil
+}
+
+func (h *eventHub) unsubscribe(sub *subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+// publish returns the number of subscriptions dropped for lagging behind
+func (h *eventHub) publish(e hubEvent) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	dropped := 0
+	for sub := range h.subs {
+		select {
+		case sub.events <- e:
+		default:
+			delete(h.subs, sub)
+			close(sub.events)
+			dropped++
+		}
+	}
+
+	return dropped
+}
+
+// close ends every subscription, so the streams end and the HTTP server can
+// shut down
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+// publishBlock streams a block just added to the chain to the subscriptions
+// and triggers the webhooks watching it
+func (n *Node) publishBlock(block database.Block) {
+	hash, err := block.Hash()
+	if err != nil {
+		return
+	}
+
+	b := addedBlock{hash, block, database.NewStateDiff(block, hash, n.state)}
+	dropped := n.events.publish(hubEvent{block: &b})
+	if dropped > 0 {
+		n.httpLog.Warn("Dropped lagging event subscriptions", "count", dropped)
+	}
+
+	n.notifyWebhooks(b)
+}
+
+// publishPendingTXs streams the TXs added to the mempool to the
+// subscriptions until the context is cancelled
+func (n *Node) publishPendingTXs(ctx context.Context) {
+	for {
+		select {
+		case tx := <-n.newPendingTXs:
+			dropped := n.events.publish(hubEvent{tx: &tx})
+			if dropped > 0 {
+				n.httpLog.Warn("Dropped lagging event subscriptions", "count", dropped)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// eventFilter is what a stream subscribed to, it keeps track of the blocks
+// including the TXs watched to count their confirmations
+type eventFilter struct {
+	blocks        bool
+	pendingTXs    bool
+	txs           map[database.Hash]bool
+	accounts      map[common.Address]bool
+	confirmations uint64
+
+	included map[database.Hash]uint64
+}
+
+func parseEventFilter(r *http.Request) (*eventFilter, error) {
+	query := r.URL.Query()
+	filter := &eventFilter{
+		txs:      make(map[database.Hash]bool),
+		accounts: make(map[common.Address]bool),
+		included: make(map[database.Hash]uint64),
+	}
+
+	for _, topic := range query[eventsEndpointQueryKeyTopic] {
+		switch topic {
+		case eventsTopicBlocks:
+			filter.blocks = true
+		case eventsTopicPendingTXs:
+			filter.pendingTXs = true
+		default:
+			return nil, fmt.Errorf("unknown topic '%s', expected '%s' or '%s'", topic, eventsTopicBlocks, eventsTopicPendingTXs)
+		}
+	}
+
+	for _, raw := range query[eventsEndpointQueryKeyTX] {
+		hash, err := parseTXHash(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		filter.txs[hash] = true
+	}
+
+	for _, raw := range query[eventsEndpointQueryKeyAccount] {
+		if !common.IsHexAddress(raw) {
+			return nil, fmt.Errorf("'%s' is not a valid account", raw)
+		}
+
+		filter.accounts[database.NewAccount(raw)] = true
+	}
+
+	if !filter.blocks && !filter.pendingTXs && len(filter.txs) == 0 && len(filter.accounts) == 0 {
+		return nil, fmt.Errorf("nothing to subscribe to, set '%s', '%s' or '%s'", eventsEndpointQueryKeyTopic, eventsEndpointQueryKeyTX, eventsEndpointQueryKeyAccount)
+	}
+
+	confirmations, err := parseUintQuery(r, eventsEndpointQueryKeyConfirmations, 0)
+	if err != nil {
+		return nil, err
+	}
+	filter.confirmations = confirmations
+
+	return filter, nil
+}
+
+// parseTXHash parses a TX hash in hex, with or without the 0x prefix
+func parseTXHash(raw string) (database.Hash, error) {
+	hash := database.Hash{}
+	hex := strings.TrimPrefix(raw, "0x")
+	if len(hex) != 2*len(hash) || hash.UnmarshalText([]byte(hex)) != nil {
+		return database.Hash{}, fmt.Errorf("'%s' is not a valid TX hash", raw)
+	}
+
+	return hash, nil
+}
+
+func (f *eventFilter) blockEvents(b addedBlock) []Event {
+	events := make([]Event, 0)
+	number := b.block.Header.Number
+
+	if f.blocks {
+		events = append(events, Event{EventBlock, BlockEvent{b.hash, b.block}})
+	}
+
+	for _, tx := range b.block.TXs {
+		txHash, err := tx.Hash()
+		if err == nil && f.txs[txHash] {
+			f.included[txHash] = number
+		}
+	}
+
+	for txHash, includedIn := range f.included {
+		confirmations := number - includedIn + 1
+		events = append(events, Event{EventTXConfirmation, TXConfirmationEvent{txHash, b.hash, number, confirmations}})
+
+		if f.confirmations > 0 && confirmations >= f.confirmations {
+			delete(f.included, txHash)
+			delete(f.txs, txHash)
+		}
+	}
+
+	for account, state := range b.diff.Accounts {
+		if f.accounts[account] {
+			events = append(events, Event{EventBalance, BalanceRes{b.hash, number, account, state.Balance, state.Nonce}})
+		}
+	}
+
+	return events
+}
+
+func (f *eventFilter) pendingTXEvents(tx database.SignedTx) []Event {
+	if !f.pendingTXs {
+		return nil
+	}
+
+	txHash, err := tx.Hash()
+	if err != nil {
+		return nil
+	}
+
+	return []Event{{EventPendingTX, PendingTXEvent{txHash, tx}}}
+}
+
+// parseResumeHeight returns the height to stream blocks from, set by the
+// fromHeight query parameter or by the Last-Event-ID header of a reconnecting
+// client, which is the number of the last block it received
+func parseResumeHeight(r *http.Request) (uint64, bool, error) {
+	if r.URL.Query().Get(eventsEndpointQueryKeyFromHeight) != "" {
+		height, err := parseUintQuery(r, eventsEndpointQueryKeyFromHeight, 0)
+		return height, err == nil, err
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		return 0, false, nil
+	}
+
+	number, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid Last-Event-ID header. %s", err.Error())
+	}
+
+	return number + 1, true, nil
+}
+
+func writeEvent(w io.Writer, e Event) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+	return err
+}
+
+// writeBlockEvents writes the events of a block followed by its number as the
+// event ID, which is only recorded once all of them were received
+func writeBlockEvents(w io.Writer, filter *eventFilter, b addedBlock) error {
+	for _, e := range filter.blockEvents(b) {
+		err := writeEvent(w, e)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "id: %d\n\n", b.block.Header.Number)
+	return err
+}
+
+// replayedBlock rebuilds what the block changed for the accounts watched, as
+// the state has moved on since the block was added
+func (n *Node) replayedBlock(block database.Block, filter *eventFilter) (addedBlock, error) {
+	hash, err := block.Hash()
+	if err != nil {
+		return addedBlock{}, err
+	}
+
+	diff := database.StateDiff{Number: block.Header.Number, Hash: hash, Accounts: make(map[common.Address]database.AccountState)}
+	touched := []common.Address{block.Header.Miner}
+	for _, tx := range block.TXs {
+		touched = append(touched, tx.From, tx.To)
+	}
+
+	for _, account := range touched {
+		if !filter.accounts[account] {
+			continue
+		}
+
+		state, err := n.state.AccountAt(account, block.Header.Number)
+		if err != nil {
+			return addedBlock{}, err
+		}
+		diff.Accounts[account] = state
+	}
+
+	return addedBlock{hash, block, diff}, nil
+}
+
+func eventsHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	from, resume, err := parseResumeHeight(r)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeErrRes(w, fmt.Errorf("streaming isn't supported"))
+		return
+	}
+
+	if resume && from < node.state.LowestFullBlock() {
+		writeErrRes(w, fmt.Errorf("block %d is pruned, this node streams blocks from %d", from, node.state.LowestFullBlock()))
+		return
+	}
+
+	// Subscribed before reading the tip, so every block added after it is
+	// received and those up to it are replayed from the blocks DB
+	sub, err := node.events.subscribe()
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+	defer node.events.unsubscribe(sub)
+
+	next := node.state.NextBlockNumber()
+	if !resume {
+		from = next
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for from < next {
+		blocks, err := database.GetBlocksFrom(from, node.dataDir, syncEndpointMaxLimit)
+		if err != nil || len(blocks) == 0 {
+			node.httpLog.Error("Unable to replay blocks to event stream", "from", from, "err", err)
+			return
+		}
+
+		for _, block := range blocks {
+			if block.Header.Number >= next {
+				break
+			}
+
+			b, err := node.replayedBlock(block, filter)
+			if err == nil {
+				err = writeBlockEvents(w, filter, b)
+			}
+			if err != nil {
+				node.httpLog.Debug("Event stream ended", "err", err)
+				return
+			}
+			from = block.Header.Number + 1
+		}
+		flusher.Flush()
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+
+		select {
+		case e, ok := <-sub.events:
+			if !ok {
+				return
+			}
+
+			if e.block != nil && e.block.block.Header.Number >= from {
+				from = e.block.block.Header.Number + 1
+				err = writeBlockEvents(w, filter, *e.block)
+			}
+
+			if e.tx != nil {
+				for _, event := range filter.pendingTXEvents(*e.tx) {
+					err = writeEvent(w, event)
+					if err != nil {
+						break
+					}
+				}
+			}
+		case <-keepAlive.C:
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+
+		if err != nil {
+			node.httpLog.Debug("Event stream ended", "err", err)
+			return
+		}
+		flusher.Flush()
+	}
+}
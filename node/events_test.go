@@ -0,0 +1,119 @@
+package node
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jTanG0506/go-blockchain/database"
+)
+
+func TestEventsHandler(t *testing.T) {
+	dataDir, toshi, _, err := setupTestNodeDir(t, 1000000)
+	defer teardownTestNodeDir(dataDir)
+	if err != nil {
+		t.Fatalf("error setting up test node directory. %s", err.Error())
+	}
+
+	n := NewNode(dataDir, "127.0.0.1", 8085, toshi)
+	n.state, err = database.NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+	defer n.state.Close()
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s?topic=blocks&account=%s", eventsEndpoint, toshi.Hex()), nil)
+	res := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		eventsHandler(res, req, n)
+		close(done)
+	}()
+
+	// The block reaches the stream once the handler subscribed
+	block := database.NewBlock(database.Hash{}, 0, 0, uint64(time.Now().Unix()), toshi, []database.SignedTx{})
+	for !hasSubscriptions(n.events) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	n.publishBlock(block)
+	n.events.close()
+	<-done
+
+	body := res.Body.String()
+	for _, expected := range []string{"event: block\n", "event: balance\n", "id: 0\n"} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected stream to contain %q, got %q", expected, body)
+		}
+	}
+
+	if strings.Index(body, "id: 0\n") < strings.Index(body, "event: balance\n") {
+		t.Fatalf("expected the block's ID after its events, got %q", body)
+	}
+}
+
+func hasSubscriptions(h *eventHub) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subs) > 0
+}
+
+func TestEventFilterConfirmations(t *testing.T) {
+	tx := database.SignedTx{Tx: database.NewTx(database.NewAccount("0x01"), database.NewAccount("0x02"), 1, 10, "")}
+	txHash, err := tx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := &eventFilter{
+		txs:           map[database.Hash]bool{txHash: true},
+		included:      make(map[database.Hash]uint64),
+		confirmations: 2,
+	}
+
+	blocks := []database.Block{
+		database.NewBlock(database.Hash{}, 0, 0, 0, database.NewAccount("0x03"), []database.SignedTx{}),
+		database.NewBlock(database.Hash{}, 1, 0, 0, database.NewAccount("0x03"), []database.SignedTx{tx}),
+		database.NewBlock(database.Hash{}, 2, 0, 0, database.NewAccount("0x03"), []database.SignedTx{}),
+		database.NewBlock(database.Hash{}, 3, 0, 0, database.NewAccount("0x03"), []database.SignedTx{}),
+	}
+
+	expected := []uint64{0, 1, 2, 0}
+	for i, block := range blocks {
+		events := filter.blockEvents(addedBlock{block: block})
+
+		confirmations := uint64(0)
+		for _, e := range events {
+			confirmations = e.Data.(TXConfirmationEvent).Confirmations
+		}
+
+		if confirmations != expected[i] {
+			t.Fatalf("expected %d confirmations at block %d, got %d from %+v", expected[i], i, confirmations, events)
+		}
+	}
+}
+
+func TestParseResumeHeight(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, eventsEndpoint, nil)
+	_, resume, err := parseResumeHeight(req)
+	if err != nil || resume {
+		t.Fatalf("expected no resume height without query or header, got %v. %v", resume, err)
+	}
+
+	req.Header.Set("Last-Event-ID", "41")
+	height, resume, err := parseResumeHeight(req)
+	if err != nil || !resume || height != 42 {
+		t.Fatalf("expected to resume after the last event ID from 42, got %d", height)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, eventsEndpoint+"?fromHeight=7", nil)
+	req.Header.Set("Last-Event-ID", "41")
+	height, resume, err = parseResumeHeight(req)
+	if err != nil || !resume || height != 7 {
+		t.Fatalf("expected fromHeight to take precedence, got %d", height)
+	}
+}
@@ -0,0 +1,119 @@
+package node
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jTanG0506/go-blockchain/database"
+)
+
+const healthzEndpoint = "/healthz"
+const readyzEndpoint = "/readyz"
+
+const DefaultReadyMinPeers = 0
+const DefaultReadyMaxBlockLag = 2
+
+// HealthConfig sets when the node reports itself ready to serve traffic
+type HealthConfig struct {
+	// ReadyMinPeers is the number of known peers the node needs
+	ReadyMinPeers int
+	// ReadyMaxBlockLag is how many blocks the node may be behind the best
+	// peer's height from the last sync
+	ReadyMaxBlockLag uint64
+}
+
+func DefaultHealthConfig() HealthConfig {
+	return HealthConfig{
+		ReadyMinPeers:    DefaultReadyMinPeers,
+		ReadyMaxBlockLag: DefaultReadyMaxBlockLag,
+	}
+}
+
+type HealthCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+type HealthRes struct {
+	OK     bool          `json:"ok"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+func (n *Node) SetHealthConfig(config HealthConfig) {
+	n.healthConfig = config
+}
+
+// healthChecks tell whether the node is alive, i.e. running and able to
+// persist blocks
+func (n *Node) healthChecks() []HealthCheck {
+	checks := []HealthCheck{{Name: "process", OK: true}}
+
+	err := database.CheckDataDirWritable(n.dataDir)
+	checks = append(checks, newHealthCheck("datadir_writable", err))
+
+	return checks
+}
+
+// readyChecks tell whether the node has caught up with its peers and can
+// serve up to date data
+func (n *Node) readyChecks() []HealthCheck {
+	var stateErr error
+	if n.state == nil {
+		stateErr = fmt.Errorf("blockchain state isn't loaded")
+	}
+	checks := []HealthCheck{newHealthCheck("state_loaded", stateErr)}
+	if stateErr != nil {
+		return checks
+	}
+
+	var peersErr error
+	if peers := n.countKnownPeers(); peers < n.healthConfig.ReadyMinPeers {
+		peersErr = fmt.Errorf("%d known peers, at least %d required", peers, n.healthConfig.ReadyMinPeers)
+	}
+	checks = append(checks, newHealthCheck("peers", peersErr))
+
+	var syncErr error
+	height := n.state.LastBlock().Header.Number
+	if n.SyncState() == SyncStateDiscovering {
+		syncErr = fmt.Errorf("node hasn't synced with its peers yet")
+	} else if bestPeerNumber := n.BestPeerNumber(); bestPeerNumber > height+n.healthConfig.ReadyMaxBlockLag {
+		syncErr = fmt.Errorf("%d blocks behind the best peer, at most %d allowed", bestPeerNumber-height, n.healthConfig.ReadyMaxBlockLag)
+	}
+	checks = append(checks, newHealthCheck("synced", syncErr))
+
+	return checks
+}
+
+func newHealthCheck(name string, err error) HealthCheck {
+	if err != nil {
+		return HealthCheck{Name: name, OK: false, Message: err.Error()}
+	}
+
+	return HealthCheck{Name: name, OK: true}
+}
+
+func healthzHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	writeHealthRes(w, node.healthChecks())
+}
+
+func readyzHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	writeHealthRes(w, node.readyChecks())
+}
+
+// writeHealthRes responds 200 when every check passed and 503 otherwise
+func writeHealthRes(w http.ResponseWriter, checks []HealthCheck) {
+	res := HealthRes{OK: true, Checks: checks}
+	for _, check := range checks {
+		if !check.OK {
+			res.OK = false
+		}
+	}
+
+	status := http.StatusOK
+	if !res.OK {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeResWithStatus(w, status, res)
+}
@@ -0,0 +1,106 @@
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/jTanG0506/go-blockchain/database"
+)
+
+func TestReadyChecks(t *testing.T) {
+	dataDir, toshi, _, err := setupTestNodeDir(t, 1000000)
+	defer teardownTestNodeDir(dataDir)
+	if err != nil {
+		t.Fatalf("error setting up test node directory. %s", err.Error())
+	}
+
+	n := NewNode(dataDir, "127.0.0.1", 8085, toshi)
+	if isReady(n.readyChecks()) {
+		t.Fatalf("node without a loaded state shouldn't be ready")
+	}
+
+	n.state, err = database.NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+	defer n.state.Close()
+
+	if isReady(n.readyChecks()) {
+		t.Fatalf("node which hasn't synced yet shouldn't be ready")
+	}
+
+	n.updateSyncState(nil)
+	if !isReady(n.readyChecks()) {
+		t.Fatalf("synced node without peers should be ready by default, got %+v", n.readyChecks())
+	}
+
+	n.SetHealthConfig(HealthConfig{ReadyMinPeers: 1, ReadyMaxBlockLag: DefaultReadyMaxBlockLag})
+	if isReady(n.readyChecks()) {
+		t.Fatalf("node without peers shouldn't be ready when 1 peer is required")
+	}
+
+	n.AddPeer(NewPeerNode("127.0.0.1", 8086, false, toshi, true))
+	n.bestPeerNumber = DefaultReadyMaxBlockLag + 1
+	if isReady(n.readyChecks()) {
+		t.Fatalf("node %d blocks behind its best peer shouldn't be ready", n.bestPeerNumber)
+	}
+
+	n.bestPeerNumber = DefaultReadyMaxBlockLag
+	if !isReady(n.readyChecks()) {
+		t.Fatalf("node within the allowed lag should be ready, got %+v", n.readyChecks())
+	}
+}
+
+func TestReadyzHandlerWhilePeersChange(t *testing.T) {
+	dataDir, toshi, jtang, err := setupTestNodeDir(t, 1000000)
+	defer teardownTestNodeDir(dataDir)
+	if err != nil {
+		t.Fatalf("error setting up test node directory. %s", err.Error())
+	}
+
+	n := NewNode(dataDir, "127.0.0.1", 8085, toshi)
+	n.state, err = database.NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+	defer n.state.Close()
+
+	n.updateSyncState(nil)
+	n.SetHealthConfig(HealthConfig{ReadyMinPeers: 1, ReadyMaxBlockLag: DefaultReadyMaxBlockLag})
+
+	// Run with -race, the sync loop adds and removes peers while probes
+	// count them
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := uint64(0); i < 100; i++ {
+			peer := NewPeerNode("127.0.0.1", 9000+i, false, jtang, true)
+			n.AddPeer(peer)
+			n.RemovePeer(peer)
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		readyzHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/readyz", nil), n)
+	}
+	wg.Wait()
+
+	res := httptest.NewRecorder()
+	readyzHandler(res, httptest.NewRequest(http.MethodGet, "/readyz", nil), n)
+	if res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected node without peers to be unready, got %d %s", res.Code, res.Body.String())
+	}
+}
+
+func isReady(checks []HealthCheck) bool {
+	for _, check := range checks {
+		if !check.OK {
+			return false
+		}
+	}
+
+	return true
+}
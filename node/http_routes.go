@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/jTanG0506/go-blockchain/database"
 	"github.com/jTanG0506/go-blockchain/wallet"
 )
@@ -19,11 +21,22 @@ type BalancesRes struct {
 	Balances map[common.Address]uint `json:"balances"`
 }
 
+type BalanceRes struct {
+	Hash    database.Hash  `json:"block_hash"`
+	Number  uint64         `json:"block_number"`
+	Account common.Address `json:"account"`
+	Balance uint           `json:"balance"`
+	Nonce   uint           `json:"nonce"`
+}
+
 type StatusRes struct {
-	Hash       database.Hash       `json:"block_hash"`
-	Number     uint64              `json:"block_number"`
-	KnownPeers map[string]PeerNode `json:"peers_known"`
-	PendingTXs []database.SignedTx `json:"pending_txs"`
+	Hash            database.Hash       `json:"block_hash"`
+	Number          uint64              `json:"block_number"`
+	LowestFullBlock uint64              `json:"lowest_full_block_number"`
+	KnownPeers      map[string]PeerNode `json:"peers_known"`
+	PendingTXs      []database.SignedTx `json:"pending_txs"`
+	SyncState       SyncState           `json:"sync_state"`
+	BestPeerNumber  uint64              `json:"best_peer_block_number"`
 }
 
 type AddTXReq struct {
@@ -38,6 +51,22 @@ type AddTXRes struct {
 	Success bool `json:"success"`
 }
 
+type NonceRes struct {
+	Account common.Address `json:"account"`
+	Nonce   uint           `json:"nonce"`
+}
+
+type VerifyMessageReq struct {
+	Address   string `json:"address"`
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+}
+
+type VerifyMessageRes struct {
+	Valid  bool           `json:"valid"`
+	Signer common.Address `json:"signer"`
+}
+
 type SyncRes struct {
 	Blocks []database.Block `json:"blocks"`
 }
@@ -51,18 +80,62 @@ func listBalancesHandler(w http.ResponseWriter, r *http.Request, state *database
 	writeRes(w, BalancesRes{state.LatestBlockHash(), state.Balances})
 }
 
+// balanceHandler serves /balances/{account}, as of the block with the height
+// query parameter's number if given and of the latest block otherwise
+func balanceHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	rawAccount := strings.TrimPrefix(r.URL.Path, balanceEndpoint)
+	if !common.IsHexAddress(rawAccount) {
+		writeErrRes(w, fmt.Errorf("'%s' is an invalid account", rawAccount))
+		return
+	}
+
+	account := database.NewAccount(rawAccount)
+	if r.URL.Query().Get(balanceEndpointQueryKeyHeight) == "" {
+		writeRes(w, BalanceRes{
+			Hash:    node.state.LatestBlockHash(),
+			Number:  node.state.LastBlock().Header.Number,
+			Account: account,
+			Balance: node.state.Balances[account],
+			Nonce:   node.state.AccountsToNonce[account],
+		})
+		return
+	}
+
+	height, err := parseUintQuery(r, balanceEndpointQueryKeyHeight, 0)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	state, err := node.state.AccountAt(account, height)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, BalanceRes{state.Hash, state.Number, account, state.Balance, state.Nonce})
+}
+
 func statusHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	res := StatusRes{
-		Hash:       node.state.LatestBlockHash(),
-		Number:     node.state.LastBlock().Header.Number,
-		KnownPeers: node.knownPeers,
-		PendingTXs: node.getPendingTXsAsArray(),
+		Hash:            node.state.LatestBlockHash(),
+		Number:          node.state.LastBlock().Header.Number,
+		LowestFullBlock: node.state.LowestFullBlock(),
+		KnownPeers:      node.getKnownPeers(),
+		PendingTXs:      node.getPendingTXsAsArray(),
+		SyncState:       node.SyncState(),
+		BestPeerNumber:  node.BestPeerNumber(),
 	}
 
 	writeRes(w, res)
 }
 
 func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !node.IsSynced() {
+		writeErrRes(w, fmt.Errorf("node still syncing, currently '%s'", node.SyncState()))
+		return
+	}
+
 	req := AddTXReq{}
 	err := readRequest(r, &req)
 	if err != nil {
@@ -81,12 +154,12 @@ func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 		return
 	}
 
-	nonce := node.state.GetNextAccountNonce(from)
+	nonce, _ := node.getPendingTXsOf(from)
 	tx := database.NewTx(
 		from,
 		database.NewAccount(req.To),
-		nonce,
 		req.Value,
+		nonce,
 		req.Data,
 	)
 
@@ -101,6 +174,12 @@ func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 		return
 	}
 
+	err = node.validatePendingTX(signedTx)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
 	err = node.AddPendingTX(signedTx, node.info)
 	if err != nil {
 		writeErrRes(w, err)
@@ -110,6 +189,88 @@ func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	writeRes(w, AddTXRes{Success: true})
 }
 
+// txAddSignedHandler accepts TXs signed outside of the node, such as TXs from
+// multisig accounts, without needing the sender's keystore
+func txAddSignedHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if !node.IsSynced() {
+		writeErrRes(w, fmt.Errorf("node still syncing, currently '%s'", node.SyncState()))
+		return
+	}
+
+	signedTx := database.SignedTx{}
+	err := readRequest(r, &signedTx)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	ok, err := signedTx.IsSigAuthentic()
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	if !ok {
+		writeErrRes(w, fmt.Errorf("wrong Tx, sender '%s' is forged", signedTx.From.String()))
+		return
+	}
+
+	err = node.validatePendingTX(signedTx)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	err = node.AddPendingTX(signedTx, node.info)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, AddTXRes{Success: true})
+}
+
+func nonceHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	rawAccount := r.URL.Query().Get(nonceEndpointQueryKeyAccount)
+	if !common.IsHexAddress(rawAccount) {
+		writeErrRes(w, fmt.Errorf("'%s' is an invalid account", rawAccount))
+		return
+	}
+
+	// The next TX is mined after the account's pending TXs
+	account := database.NewAccount(rawAccount)
+	nonce, _ := node.getPendingTXsOf(account)
+	writeRes(w, NonceRes{account, nonce})
+}
+
+func verifyMessageHandler(w http.ResponseWriter, r *http.Request) {
+	req := VerifyMessageReq{}
+	err := readRequest(r, &req)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	if !common.IsHexAddress(req.Address) {
+		writeErrRes(w, fmt.Errorf("'%s' is an invalid address", req.Address))
+		return
+	}
+
+	sig, err := hexutil.Decode(req.Signature)
+	if err != nil {
+		writeErrRes(w, fmt.Errorf("invalid signature. %s", err.Error()))
+		return
+	}
+
+	signer, err := wallet.VerifyMessage([]byte(req.Message), sig)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, VerifyMessageRes{signer == database.NewAccount(req.Address), signer})
+}
+
 func syncHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	reqHash := r.URL.Query().Get(syncEndpointQueryKeyFromBlock)
 	hash := database.Hash{}
@@ -120,7 +281,23 @@ func syncHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 		return
 	}
 
-	blocks, err := database.GetBlocksAfter(hash, node.dataDir)
+	offset, err := parseUintQuery(r, syncEndpointQueryKeyOffset, 0)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	limit, err := parseUintQuery(r, syncEndpointQueryKeyLimit, syncEndpointMaxLimit)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	if limit == 0 || limit > syncEndpointMaxLimit {
+		limit = syncEndpointMaxLimit
+	}
+
+	blocks, err := node.state.BlocksAfter(hash, offset, limit)
 	if err != nil {
 		writeErrRes(w, err)
 		return
@@ -142,7 +319,7 @@ func addPeerHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 
 	peer := NewPeerNode(peerIP, peerPort, false, database.NewAccount(minerRaw), true)
 	node.AddPeer(peer)
-	fmt.Printf("Peer '%s' was added into KnownPeers\n", peer.TcpAddress())
+	node.httpLog.Info("Peer was added into KnownPeers", "peer", peer.TcpAddress())
 
 	writeRes(w, AddPeerRes{true, ""})
 }
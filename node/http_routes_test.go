@@ -0,0 +1,65 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jTanG0506/go-blockchain/database"
+	"github.com/jTanG0506/go-blockchain/wallet"
+)
+
+func TestTxAddSignedHandler(t *testing.T) {
+	dataDir, toshi, jtang, err := setupTestNodeDir(t, 1000)
+	defer teardownTestNodeDir(dataDir)
+	if err != nil {
+		t.Fatalf("error setting up test node directory. %s", err.Error())
+	}
+
+	n := NewNode(dataDir, "127.0.0.1", 8085, toshi)
+	n.state, err = database.NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+	defer n.state.Close()
+	n.updateSyncState(nil)
+
+	tests := []struct {
+		name     string
+		value    uint
+		nonce    uint
+		accepted bool
+	}{
+		{"wrong nonce", 100, 2, false},
+		{"next nonce", 100, 1, true},
+		{"nonce already pending", 100, 1, false},
+		{"nonce after the pending TX", 100, 2, true},
+		{"value above the balance left", 700, 3, false},
+	}
+
+	for _, test := range tests {
+		tx := database.NewTx(toshi, jtang, test.value, test.nonce, "")
+		signedTx, err := wallet.SignTxWithKeystoreAccount(tx, toshi, testKsToshiPwd, wallet.GetKeystoreDirPath(dataDir))
+		if err != nil {
+			t.Fatalf("unable to sign tx with keystore account: %s", err.Error())
+		}
+
+		body, err := json.Marshal(signedTx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := httptest.NewRecorder()
+		txAddSignedHandler(res, httptest.NewRequest(http.MethodPost, addSignedTXEndpoint, bytes.NewReader(body)), n)
+
+		if accepted := res.Code == http.StatusOK; accepted != test.accepted {
+			t.Fatalf("%s: expected TX to be accepted: %v, got %d %s", test.name, test.accepted, res.Code, res.Body.String())
+		}
+	}
+
+	if len(n.pendingTXs) != 2 {
+		t.Fatalf("expected the 2 accepted TXs to be pending, got %d", len(n.pendingTXs))
+	}
+}
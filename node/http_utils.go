@@ -1,12 +1,27 @@
 package node
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 )
 
+// cancelOnCloseBody releases a request's context once its response body has
+// been fully consumed and closed.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
 func writeErrRes(w http.ResponseWriter, err error) {
 	jsonErrRes, _ := json.Marshal(ErrorRes{err.Error()})
 	w.Header().Set("Content-Type", "application/json")
@@ -15,6 +30,10 @@ func writeErrRes(w http.ResponseWriter, err error) {
 }
 
 func writeRes(w http.ResponseWriter, content interface{}) {
+	writeResWithStatus(w, http.StatusOK, content)
+}
+
+func writeResWithStatus(w http.ResponseWriter, status int, content interface{}) {
 	jsonContent, err := json.Marshal(content)
 	if err != nil {
 		writeErrRes(w, err)
@@ -22,7 +41,7 @@ func writeRes(w http.ResponseWriter, content interface{}) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 	w.Write(jsonContent)
 }
 
@@ -55,3 +74,17 @@ func readResponse(r *http.Response, reqBody interface{}) error {
 
 	return nil
 }
+
+func parseUintQuery(r *http.Request, key string, defaultValue uint64) (uint64, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid '%s' query parameter. %s", key, err.Error())
+	}
+
+	return value, nil
+}
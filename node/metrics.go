@@ -0,0 +1,186 @@
+package node
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jTanG0506/go-blockchain/metrics"
+)
+
+const metricsEndpoint = "/metrics"
+const unmatchedRoute = "unmatched"
+
+type httpRequestKey struct {
+	route string
+	code  int
+}
+
+type nodeMetrics struct {
+	miningAttempts uint64
+	blocksMined    uint64
+	hashrateBits   uint64
+
+	mu            sync.Mutex
+	httpRequests  map[httpRequestKey]uint64
+	httpDurations map[string]*metrics.Histogram
+}
+
+func newNodeMetrics() *nodeMetrics {
+	return &nodeMetrics{
+		httpRequests:  make(map[httpRequestKey]uint64),
+		httpDurations: make(map[string]*metrics.Histogram),
+	}
+}
+
+func (m *nodeMetrics) recordMining(stats MiningStats, mined bool) {
+	atomic.AddUint64(&m.miningAttempts, stats.Attempts)
+	atomic.StoreUint64(&m.hashrateBits, math.Float64bits(stats.Hashrate()))
+	if mined {
+		atomic.AddUint64(&m.blocksMined, 1)
+	}
+}
+
+func (m *nodeMetrics) hashrate() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&m.hashrateBits))
+}
+
+func (m *nodeMetrics) recordHTTPRequest(route string, code int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.httpRequests[httpRequestKey{route, code}]++
+
+	histogram, ok := m.httpDurations[route]
+	if !ok {
+		histogram = metrics.NewHistogram(metrics.DefaultBuckets)
+		m.httpDurations[route] = histogram
+	}
+
+	histogram.ObserveDuration(duration)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streaming handlers, such as the events one, flush through the
+// recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// instrument records the count and latency of every request per route, the
+// route being the pattern the request matched rather than its raw path
+func (n *Node) instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{w, http.StatusOK}
+		mux.ServeHTTP(recorder, r)
+
+		n.metrics.recordHTTPRequest(route, recorder.status, time.Since(start))
+	})
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	mw := metrics.NewWriter(w)
+
+	lastBlock := node.state.LastBlock()
+	height := lastBlock.Header.Number
+	mw.Gauge("tbs_chain_height", "Number of the latest block.", float64(height))
+	mw.Gauge("tbs_chain_last_block_timestamp_seconds", "Unix time of the latest block.", float64(lastBlock.Header.Time))
+
+	lag := uint64(0)
+	if bestPeerNumber := node.BestPeerNumber(); bestPeerNumber > height {
+		lag = bestPeerNumber - height
+	}
+	mw.Gauge("tbs_sync_lag_blocks", "Blocks behind the best peer as of the last sync.", float64(lag))
+
+	for _, state := range []SyncState{SyncStateDiscovering, SyncStateCatchingUp, SyncStateSynced} {
+		value := 0.0
+		if node.SyncState() == state {
+			value = 1
+		}
+		mw.Gauge("tbs_sync_state", "Current sync state of the node.", value, "state", string(state))
+	}
+
+	knownPeers := 0
+	activePeers := 0
+	for _, peer := range node.getKnownPeers() {
+		if peer.IP == node.info.IP && peer.Port == node.info.Port {
+			continue
+		}
+
+		knownPeers++
+		if peer.IsActive {
+			activePeers++
+		}
+	}
+	mw.Gauge("tbs_peers_known", "Number of known peers.", float64(knownPeers))
+	mw.Gauge("tbs_peers_active", "Number of known peers this node joined.", float64(activePeers))
+
+	pendingTXs, archivedTXs := node.countTXs()
+	mw.Gauge("tbs_txs_pending", "Number of TXs waiting to be mined.", float64(pendingTXs))
+	mw.Gauge("tbs_txs_archived", "Number of TXs mined since the node started.", float64(archivedTXs))
+
+	mw.Counter("tbs_mining_attempts_total", "Proof of work hashes computed.", float64(atomic.LoadUint64(&node.metrics.miningAttempts)))
+	mw.Counter("tbs_mining_blocks_mined_total", "Blocks mined by this node.", float64(atomic.LoadUint64(&node.metrics.blocksMined)))
+	mw.Gauge("tbs_mining_hashrate", "Hashes per second of the latest mining round.", node.metrics.hashrate())
+
+	mw.Histogram("tbs_block_validation_seconds", "Time taken to validate blocks added to the state.", node.state.BlockValidationTime())
+
+	writeHTTPMetrics(mw, node.metrics)
+
+	if mw.Err() != nil {
+		node.httpLog.Error("Failed to write metrics", "err", mw.Err())
+	}
+}
+
+func writeHTTPMetrics(mw *metrics.Writer, m *nodeMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]httpRequestKey, 0, len(m.httpRequests))
+	for key := range m.httpRequests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+
+		return keys[i].code < keys[j].code
+	})
+
+	for _, key := range keys {
+		mw.Counter("tbs_http_requests_total", "HTTP requests per route and status code.", float64(m.httpRequests[key]), "route", key.route, "code", strconv.Itoa(key.code))
+	}
+
+	routes := make([]string, 0, len(m.httpDurations))
+	for route := range m.httpDurations {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	for _, route := range routes {
+		mw.Histogram("tbs_http_request_duration_seconds", "Latency of HTTP requests per route.", m.httpDurations[route], "route", route)
+	}
+}
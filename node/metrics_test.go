@@ -0,0 +1,56 @@
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jTanG0506/go-blockchain/database"
+)
+
+func TestMetricsHandlerWhilePeersAndTXsChange(t *testing.T) {
+	dataDir, toshi, jtang, err := setupTestNodeDir(t, 1000000)
+	defer teardownTestNodeDir(dataDir)
+	if err != nil {
+		t.Fatalf("error setting up test node directory. %s", err.Error())
+	}
+
+	n := NewNode(dataDir, "127.0.0.1", 8085, toshi)
+	n.state, err = database.NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+	defer n.state.Close()
+
+	// Run with -race, the sync and mining loops update peers and TXs while
+	// scrapers read them
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := uint64(0); i < 100; i++ {
+			peer := NewPeerNode("127.0.0.1", 9000+i, false, jtang, true)
+			n.AddPeer(peer)
+			n.RemovePeer(peer)
+
+			tx := database.SignedTx{Tx: database.NewTx(toshi, jtang, 1, uint(i)+1, "")}
+			n.AddPendingTX(tx, peer)
+			n.removeMinedPendingTXs(database.NewBlock(database.Hash{}, 1, 0, 0, toshi, []database.SignedTx{tx}))
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		res := httptest.NewRecorder()
+		metricsHandler(res, httptest.NewRequest(http.MethodGet, "/metrics", nil), n)
+		if !strings.Contains(res.Body.String(), "tbs_txs_pending") {
+			t.Fatalf("expected the pending TXs gauge, got %q", res.Body.String())
+		}
+	}
+	wg.Wait()
+
+	if pending, archived := n.countTXs(); pending != 0 || archived != 100 {
+		t.Fatalf("expected every TX to be archived, got %d pending and %d archived", pending, archived)
+	}
+}
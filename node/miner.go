@@ -3,63 +3,238 @@ package node
 import (
 	"context"
 	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/jTanG0506/go-blockchain/database"
 )
 
+type MiningPolicy string
+
+const (
+	// MiningPolicyTXs only mines a block once there are pending TXs
+	MiningPolicyTXs MiningPolicy = "txs"
+	// MiningPolicyAlways mines blocks back to back, empty or not
+	MiningPolicyAlways MiningPolicy = "always"
+	// MiningPolicySchedule mines one block, empty or not, every mining interval
+	MiningPolicySchedule MiningPolicy = "schedule"
+)
+
+const DefaultMiningPolicy = MiningPolicyTXs
+const DefaultMaxTXsPerBlock = 0
+const DefaultMinBlockInterval = time.Duration(0)
+
+// DefaultMiningThreads of 0 uses one mining worker per CPU
+const DefaultMiningThreads = 0
+
+const miningProgressInterval = 5 * time.Second
+const miningCancelCheckInterval = 1 << 12
+
+// alwaysMiningPollInterval is how often an idle miner running the 'always'
+// policy checks whether it can start on the next block.
+const alwaysMiningPollInterval = time.Second
+
+type MiningConfig struct {
+	Policy MiningPolicy
+	// Interval is how often the node considers mining a new block
+	Interval time.Duration
+	// MaxTXsPerBlock caps the number of pending TXs in a block, 0 is unlimited
+	MaxTXsPerBlock int
+	// MinBlockInterval is the shortest time allowed between our tip and the
+	// next block this node mines
+	MinBlockInterval time.Duration
+	// Threads is the number of PoW workers, 0 uses one per CPU
+	Threads int
+}
+
+func DefaultMiningConfig() MiningConfig {
+	return MiningConfig{
+		Policy:           DefaultMiningPolicy,
+		Interval:         time.Second * miningIntervalInSeconds,
+		MaxTXsPerBlock:   DefaultMaxTXsPerBlock,
+		MinBlockInterval: DefaultMinBlockInterval,
+		Threads:          DefaultMiningThreads,
+	}
+}
+
+func ParseMiningPolicy(policy string) (MiningPolicy, error) {
+	switch MiningPolicy(policy) {
+	case MiningPolicyTXs, MiningPolicyAlways, MiningPolicySchedule:
+		return MiningPolicy(policy), nil
+	}
+
+	return "", fmt.Errorf("unknown mining policy '%s', expected one of '%s', '%s' or '%s'", policy, MiningPolicyTXs, MiningPolicyAlways, MiningPolicySchedule)
+}
+
 type PendingBlock struct {
-	parent database.Hash
-	number uint64
-	time   uint64
-	miner  common.Address
-	txs    []database.SignedTx
+	parent  database.Hash
+	number  uint64
+	time    uint64
+	miner   common.Address
+	txs     []database.SignedTx
+	version uint8
 }
 
 func NewPendingBlock(parent database.Hash, number uint64, miner common.Address, txs []database.SignedTx) PendingBlock {
-	return PendingBlock{parent, number, uint64(time.Now().Unix()), miner, txs}
+	return PendingBlock{parent, number, uint64(time.Now().Unix()), miner, txs, database.EncodingVersionJSON}
+}
+
+// WithVersion returns a copy of the pending block to be mined using the given
+// block encoding version
+func (pb PendingBlock) WithVersion(version uint8) PendingBlock {
+	pb.version = version
+	return pb
+}
+
+// MiningStats describes the work done while mining a single block
+type MiningStats struct {
+	Attempts uint64
+	Duration time.Duration
+}
+
+func (s MiningStats) Hashrate() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+
+	return float64(s.Attempts) / s.Duration.Seconds()
 }
 
 func Mine(ctx context.Context, pb PendingBlock) (database.Block, error) {
-	if len(pb.txs) == 0 {
-		return database.Block{}, fmt.Errorf("mining empty blocks is forbidden")
+	block, _, err := MineParallel(ctx, pb, DefaultMiningThreads, log.Root().New(logComponentKey, logComponentMiner))
+	return block, err
+}
+
+// MineParallel searches for a valid nonce using the given number of workers,
+// or one per CPU if threads is 0. Each worker owns an equal slice of the
+// uint32 nonce space and, once it runs out, moves on to the same slice of the
+// next second's timestamp.
+func MineParallel(ctx context.Context, pb PendingBlock, threads int, logger log.Logger) (database.Block, MiningStats, error) {
+	if threads <= 0 {
+		threads = runtime.NumCPU()
 	}
 
 	start := time.Now()
-	nonce := uint32(0)
-	var block database.Block
-	var hash database.Hash
+	miningCtx, stopWorkers := context.WithCancel(ctx)
+	defer stopWorkers()
+
+	var attempts uint64
+	results := make(chan database.Block, threads)
+	errs := make(chan error, threads)
+
+	var wg sync.WaitGroup
+	for w := 0; w < threads; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			block, err := mineNonceRange(miningCtx, pb, w, threads, &attempts)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			results <- block
+		}(w)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	logger.Info("Mining new block", "number", pb.number, "txs", len(pb.txs), "threads", threads)
 
-	for !database.IsBlockHashValid(hash) {
+	ticker := time.NewTicker(miningProgressInterval)
+	defer ticker.Stop()
+
+	for {
 		select {
-		case <-ctx.Done():
-			fmt.Println("❌ Mining cancelled!")
-			return database.Block{}, fmt.Errorf("mining cancelled. %s", ctx.Err())
-		default:
-		}
+		case block, ok := <-results:
+			stats := MiningStats{atomic.LoadUint64(&attempts), time.Since(start)}
+			if !ok {
+				return database.Block{}, stats, miningErr(ctx, errs, logger)
+			}
 
-		nonce++
-		if nonce == 1 || nonce%1000000 == 0 {
-			fmt.Printf("⛏ Mining %d pending transactions. Attempt: %d\n", len(pb.txs), nonce)
+			stopWorkers()
+			logMinedBlock(logger, block, stats)
+			return block, stats, nil
+		case <-ticker.C:
+			stats := MiningStats{atomic.LoadUint64(&attempts), time.Since(start)}
+			logger.Debug("Mining in progress", "number", pb.number, "txs", len(pb.txs), "attempts", stats.Attempts, "hashrate", fmt.Sprintf("%.0f H/s", stats.Hashrate()))
 		}
+	}
+}
+
+// mineNonceRange tries every nonce in [w * 2^32 / threads, (w+1) * 2^32 / threads)
+// before bumping the block time by a second and starting over.
+func mineNonceRange(ctx context.Context, pb PendingBlock, w, threads int, attempts *uint64) (database.Block, error) {
+	rangeSize := (uint64(math.MaxUint32) + 1) / uint64(threads)
+	first := uint64(w) * rangeSize
+	last := first + rangeSize - 1
+	if w == threads-1 {
+		last = math.MaxUint32
+	}
 
-		block = database.NewBlock(pb.parent, pb.number, nonce, pb.time, pb.miner, pb.txs)
-		blockHash, err := block.Hash()
+	for blockTime := pb.time; ; blockTime++ {
+		block := database.NewBlock(pb.parent, pb.number, 0, blockTime, pb.miner, pb.txs)
+		block.Header.Version = pb.version
+		hasher, err := database.NewNonceHasher(block)
 		if err != nil {
 			return database.Block{}, fmt.Errorf("couldn't mine block. %s", err.Error())
 		}
 
-		hash = blockHash
+		for nonce := first; nonce <= last; nonce++ {
+			if nonce%miningCancelCheckInterval == 0 {
+				select {
+				case <-ctx.Done():
+					return database.Block{}, ctx.Err()
+				default:
+				}
+
+				atomic.AddUint64(attempts, miningCancelCheckInterval)
+			}
+
+			if database.IsBlockHashValid(hasher.Hash(uint32(nonce))) {
+				block.Header.Nonce = uint32(nonce)
+				return block, nil
+			}
+		}
+	}
+}
+
+func miningErr(ctx context.Context, errs chan error, logger log.Logger) error {
+	if ctx.Err() != nil {
+		logger.Info("Mining cancelled", "reason", ctx.Err())
+		return fmt.Errorf("mining cancelled. %s", ctx.Err())
 	}
 
-	fmt.Printf("\nMined new Block '%x' using PoW\n", hash)
-	fmt.Printf("Height: '%v'\n", block.Header.Number)
-	fmt.Printf("Nonce: '%v'\n", block.Header.Nonce)
-	fmt.Printf("Created: '%v'\n", block.Header.Time)
-	fmt.Printf("Miner: '%v'\n", block.Header.Miner.String())
-	fmt.Printf("Parent: '%v'\n", block.Header.Parent.Hex())
-	fmt.Printf("Time: %s\n\n", time.Since(start))
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return fmt.Errorf("couldn't mine block")
+	}
+}
+
+func logMinedBlock(logger log.Logger, block database.Block, stats MiningStats) {
+	hash, _ := block.Hash()
 
-	return block, nil
+	logger.Info(
+		"Mined new block using PoW",
+		"number", block.Header.Number,
+		"hash", hash.Hex(),
+		"nonce", block.Header.Nonce,
+		"time", block.Header.Time,
+		"miner", block.Header.Miner.String(),
+		"parent", block.Header.Parent.Hex(),
+		"attempts", stats.Attempts,
+		"hashrate", fmt.Sprintf("%.0f H/s", stats.Hashrate()),
+		"elapsed", stats.Duration,
+	)
 }
@@ -6,6 +6,8 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
+	"math"
 	"testing"
 	"time"
 
@@ -37,6 +39,40 @@ func TestInvalidBlockHash(t *testing.T) {
 	}
 }
 
+func TestNonceHasherMatchesBlockHash(t *testing.T) {
+	minerPrivateKey, _, miner, err := generateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate keypair: %s", err.Error())
+	}
+
+	pendingBlock, err := createRandomPendingBlock(minerPrivateKey, miner)
+	if err != nil {
+		t.Fatalf("Failed to create random pending block: %s", err.Error())
+	}
+
+	for _, version := range []uint8{database.EncodingVersionJSON, database.EncodingVersionCanonical} {
+		block := database.NewBlock(pendingBlock.parent, pendingBlock.number, 0, pendingBlock.time, pendingBlock.miner, pendingBlock.txs)
+		block.Header.Version = version
+
+		hasher, err := database.NewNonceHasher(block)
+		if err != nil {
+			t.Fatalf("Failed to create nonce hasher: %s", err.Error())
+		}
+
+		for _, nonce := range []uint32{0, 1, 9, 10, 123456, math.MaxUint32} {
+			block.Header.Nonce = nonce
+			expected, err := block.Hash()
+			if err != nil {
+				t.Fatalf("Failed to hash block: %s", err.Error())
+			}
+
+			if hasher.Hash(nonce) != expected {
+				t.Fatalf("Nonce hasher produced %s for nonce %d and version %d, expected %s", hasher.Hash(nonce).Hex(), nonce, version, expected.Hex())
+			}
+		}
+	}
+}
+
 func TestMine(t *testing.T) {
 	minerPrivateKey, _, miner, err := generateKey()
 	if err != nil {
@@ -103,7 +139,7 @@ func generateKey() (*ecdsa.PrivateKey, ecdsa.PublicKey, common.Address, error) {
 }
 
 func createRandomPendingBlock(privateKey *ecdsa.PrivateKey, acc common.Address) (PendingBlock, error) {
-	tx := database.NewTx(acc, database.NewAccount(wallet.ToshiAccount), 100, 1, "test")
+	tx := database.NewTx(acc, database.NewAccount(testKsToshiAccount), 100, 1, "test")
 	signedTx, err := wallet.SignTx(tx, privateKey)
 	if err != nil {
 		return PendingBlock{}, err
@@ -116,3 +152,92 @@ func createRandomPendingBlock(privateKey *ecdsa.PrivateKey, acc common.Address)
 		[]database.SignedTx{signedTx},
 	), nil
 }
+
+func TestShouldMine(t *testing.T) {
+	dataDir, toshi, jtang, err := setupTestNodeDir(t, 1000000)
+	defer teardownTestNodeDir(dataDir)
+	if err != nil {
+		t.Fatalf("error setting up test node directory. %s", err.Error())
+	}
+
+	n := NewNode(dataDir, "127.0.0.1", 8085, toshi)
+	n.state, err = database.NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+	defer n.state.Close()
+
+	n.pendingTXs["tx"] = database.SignedTx{Tx: database.NewTx(toshi, jtang, 1, 1, "")}
+	if n.shouldMine() {
+		t.Fatalf("expected a node which isn't synced not to mine")
+	}
+
+	n.updateSyncState(nil)
+	if !n.shouldMine() {
+		t.Fatalf("expected a synced node with pending TXs to mine")
+	}
+
+	n.isMining = true
+	if n.shouldMine() {
+		t.Fatalf("expected a node already mining not to mine another block")
+	}
+	n.isMining = false
+
+	delete(n.pendingTXs, "tx")
+	expected := map[MiningPolicy]bool{MiningPolicyTXs: false, MiningPolicyAlways: true, MiningPolicySchedule: true}
+	for policy, mines := range expected {
+		n.miningConfig.Policy = policy
+		if n.shouldMine() != mines {
+			t.Fatalf("expected policy '%s' to mine without pending TXs: %v", policy, mines)
+		}
+	}
+}
+
+func TestGetPendingTXsForBlock(t *testing.T) {
+	dataDir, toshi, jtang, err := setupTestNodeDir(t, 1000000)
+	defer teardownTestNodeDir(dataDir)
+	if err != nil {
+		t.Fatalf("error setting up test node directory. %s", err.Error())
+	}
+
+	n := NewNode(dataDir, "127.0.0.1", 8085, toshi)
+	n.state, err = database.NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+	defer n.state.Close()
+
+	// Several TXs of both senders within the same second, plus an older one
+	now := uint64(time.Now().Unix())
+	for i, tx := range []database.Tx{
+		database.NewTx(toshi, jtang, 1, 3, ""),
+		database.NewTx(jtang, toshi, 1, 2, ""),
+		database.NewTx(toshi, jtang, 1, 2, ""),
+		database.NewTx(jtang, toshi, 1, 1, ""),
+		database.NewTx(toshi, jtang, 1, 1, ""),
+	} {
+		tx.Time = now
+		if i == 4 {
+			tx.Time = now - 1
+		}
+		n.pendingTXs[fmt.Sprintf("tx%d", i)] = database.SignedTx{Tx: tx}
+	}
+
+	txs := n.getPendingTXsForBlock(1)
+	if len(txs) != 5 || txs[0].From != toshi || txs[0].Nonce != 1 {
+		t.Fatalf("expected the oldest TX first, got %+v", txs)
+	}
+
+	nonces := map[common.Address]uint{}
+	for _, tx := range txs {
+		if tx.Nonce != nonces[tx.From]+1 {
+			t.Fatalf("expected the TXs of %s to follow their nonces, got nonce %d after %d", tx.From.Hex(), tx.Nonce, nonces[tx.From])
+		}
+		nonces[tx.From] = tx.Nonce
+	}
+
+	n.miningConfig.MaxTXsPerBlock = 2
+	if txs = n.getPendingTXsForBlock(1); len(txs) != 2 || txs[0].Nonce != 1 {
+		t.Fatalf("expected the 2 oldest TXs, got %+v", txs)
+	}
+}
@@ -1,28 +1,66 @@
 package node
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/jTanG0506/go-blockchain/database"
-	"github.com/jTanG0506/go-blockchain/wallet"
 )
 
-const DefaultBootstrapIp = "127.0.0.1"
-const DefaultBootstrapPort = 8080
-const DefaultBootstrapAcc = wallet.ToshiAccount
+const DevBootstrapIp = "127.0.0.1"
+const DevBootstrapPort = 8080
+const DevBootstrapAcc = database.DevToshiAccount
 const DefaultMiner = "0x0000000000000000000000000000000000000000"
 const DefaultIP = "127.0.0.1"
 const DefaultHTTPPort = 8080
+const logComponentKey = "component"
+const logComponentSync = "sync"
+const logComponentMiner = "miner"
+const logComponentMempool = "mempool"
+const logComponentDB = "db"
+const logComponentHTTP = "http"
+const logComponentWebhooks = "webhooks"
+
+const httpShutdownTimeout = 10 * time.Second
+
 const statusEndpoint = "/node/status"
 const miningIntervalInSeconds = 10
 
 const syncEndpoint = "/node/sync"
 const syncEndpointQueryKeyFromBlock = "fromBlock"
+const syncEndpointQueryKeyOffset = "offset"
+const syncEndpointQueryKeyLimit = "limit"
+const syncEndpointMaxLimit = 500
+
+const balanceEndpoint = "/balances/"
+const balanceEndpointQueryKeyHeight = "height"
+
+const addSignedTXEndpoint = "/tx/add/signed"
+
+const verifyMessageEndpoint = "/message/verify"
+
+const nonceEndpoint = "/accounts/nonce"
+const nonceEndpointQueryKeyAccount = "account"
+
+const eventsEndpoint = "/events"
+const eventsEndpointQueryKeyTopic = "topic"
+const eventsEndpointQueryKeyTX = "tx"
+const eventsEndpointQueryKeyAccount = "account"
+const eventsEndpointQueryKeyConfirmations = "confirmations"
+const eventsEndpointQueryKeyFromHeight = "fromHeight"
+
+const webhooksEndpoint = "/webhooks"
+const webhookEndpoint = "/webhooks/"
 
 const addPeerEndpoint = "/node/peer"
 const addPeerEndpointQueryKeyIP = "ip"
@@ -47,49 +85,220 @@ type Node struct {
 
 	state           *database.State
 	knownPeers      map[string]PeerNode
+	bootstraps      []PeerNode
+	seedFile        string
+	minPeers        int
 	pendingTXs      map[string]database.SignedTx
 	archivedTXs     map[string]database.SignedTx
 	newSyncedBlocks chan database.Block
 	newPendingTXs   chan database.SignedTx
+	events          *eventHub
+	webhooks        *webhookRegistry
+	webhookQueue    chan webhookDelivery
 	isMining        bool
+	miningConfig    MiningConfig
+	healthConfig    HealthConfig
+	syncInterval    time.Duration
+	syncBatchSize   uint64
+	httpAddr        string
+	archive         bool
+	pruneKeep       uint64
+
+	logger     log.Logger
+	syncLog    log.Logger
+	minerLog   log.Logger
+	mempoolLog log.Logger
+	httpLog    log.Logger
+	webhookLog log.Logger
+
+	metrics *nodeMetrics
+
+	syncMu         sync.RWMutex
+	syncState      SyncState
+	bestPeerNumber uint64
+
+	// peersMu guards knownPeers and txsMu the pending and archived TXs, which
+	// the HTTP handlers read while the sync and mining loops update them
+	peersMu sync.RWMutex
+	txsMu   sync.RWMutex
 }
 
-func NewNode(dataDir string, ip string, port uint64, acc common.Address, bootstrap PeerNode) *Node {
+func NewNode(dataDir string, ip string, port uint64, acc common.Address, bootstraps ...PeerNode) *Node {
 	knownPeers := make(map[string]PeerNode)
-	knownPeers[bootstrap.TcpAddress()] = bootstrap
+	bootstrapPeers := make([]PeerNode, 0, len(bootstraps))
+	for _, bootstrap := range bootstraps {
+		if bootstrap.IP == "" {
+			continue
+		}
 
-	return &Node{
+		knownPeers[bootstrap.TcpAddress()] = bootstrap
+		bootstrapPeers = append(bootstrapPeers, bootstrap)
+	}
+
+	n := &Node{
 		dataDir:         dataDir,
 		info:            NewPeerNode(ip, port, false, acc, true),
 		knownPeers:      knownPeers,
+		bootstraps:      bootstrapPeers,
+		minPeers:        DefaultMinPeers,
 		pendingTXs:      make(map[string]database.SignedTx),
 		archivedTXs:     make(map[string]database.SignedTx),
 		newSyncedBlocks: make(chan database.Block),
 		newPendingTXs:   make(chan database.SignedTx, 10000),
+		events:          newEventHub(),
+		webhookQueue:    make(chan webhookDelivery, webhookQueueSize),
 		isMining:        false,
+		miningConfig:    DefaultMiningConfig(),
+		healthConfig:    DefaultHealthConfig(),
+		syncInterval:    DefaultSyncInterval,
+		syncBatchSize:   syncBlocksBatchSize,
+		httpAddr:        fmt.Sprintf(":%d", port),
+		syncState:       SyncStateDiscovering,
+		metrics:         newNodeMetrics(),
 	}
+	n.SetLogger(log.Root())
+
+	return n
 }
 
 func NewPeerNode(ip string, port uint64, isBootstrap bool, acc common.Address, isActive bool) PeerNode {
 	return PeerNode{ip, port, isBootstrap, acc, isActive}
 }
 
+// ParsePeerNode parses a peer written as host:port or account@host:port
+func ParsePeerNode(raw string, isBootstrap bool) (PeerNode, error) {
+	account := common.Address{}
+	address := raw
+	if parts := strings.SplitN(raw, "@", 2); len(parts) == 2 {
+		if !common.IsHexAddress(parts[0]) {
+			return PeerNode{}, fmt.Errorf("'%s' is not a valid peer, expected host:port or account@host:port", raw)
+		}
+
+		account = database.NewAccount(parts[0])
+		address = parts[1]
+	}
+
+	host, rawPort, err := net.SplitHostPort(address)
+	if err != nil {
+		return PeerNode{}, fmt.Errorf("'%s' is not a valid peer address. %s", address, err.Error())
+	}
+
+	port, err := strconv.ParseUint(rawPort, 10, 16)
+	if err != nil {
+		return PeerNode{}, fmt.Errorf("'%s' is not a valid peer port. %s", rawPort, err.Error())
+	}
+
+	return NewPeerNode(host, port, isBootstrap, account, false), nil
+}
+
+// SetLogger replaces the node's logger, which logs through the root logger
+// by default. Every component logs with its own component tag.
+func (n *Node) SetLogger(logger log.Logger) {
+	n.logger = logger
+	n.syncLog = logger.New(logComponentKey, logComponentSync)
+	n.minerLog = logger.New(logComponentKey, logComponentMiner)
+	n.mempoolLog = logger.New(logComponentKey, logComponentMempool)
+	n.httpLog = logger.New(logComponentKey, logComponentHTTP)
+	n.webhookLog = logger.New(logComponentKey, logComponentWebhooks)
+}
+
+func (n *Node) SetMiningConfig(config MiningConfig) {
+	n.miningConfig = config
+}
+
+// SetSeedFile sets a file of host:port lines the node picks new peers from,
+// alongside its bootstrap peers, whenever it knows fewer than its minimum
+func (n *Node) SetSeedFile(path string) {
+	n.seedFile = path
+}
+
+func (n *Node) SetMinPeers(minPeers int) {
+	n.minPeers = minPeers
+}
+
+func (n *Node) SetSyncInterval(interval time.Duration) {
+	n.syncInterval = interval
+}
+
+// SetHTTPAddr sets the address the HTTP API binds to, which defaults to the
+// node's port on every interface
+func (n *Node) SetHTTPAddr(addr string) {
+	n.httpAddr = addr
+}
+
+// SetArchive makes the node keep the state diff of every block, to answer
+// historical balance queries without replaying the chain
+func (n *Node) SetArchive(archive bool) {
+	n.archive = archive
+}
+
+// SetPruning makes the node drop the TXs of blocks more than keep blocks below
+// the tip once a state snapshot covers them, 0 keeps every block
+func (n *Node) SetPruning(keep uint64) {
+	n.pruneKeep = keep
+}
+
 func (n *Node) Run(ctx context.Context) error {
-	fmt.Printf("Listening on: %s:%d\n", n.info.IP, n.info.Port)
-	state, err := database.NewStateFromDisk(n.dataDir)
+	n.logger.Info("Listening", "ip", n.info.IP, "port", n.info.Port, "http_addr", n.httpAddr)
+
+	if n.archive && n.pruneKeep > 0 {
+		return fmt.Errorf("archive mode and pruning can't be enabled together")
+	}
+
+	loadState := database.NewStateFromDisk
+	if n.archive {
+		loadState = database.NewArchiveStateFromDisk
+	}
+
+	state, err := loadState(n.dataDir)
 	if err != nil {
 		return err
 	}
 	defer state.Close()
 
+	state.SetLogger(n.logger.New(logComponentKey, logComponentDB))
+	state.SetPruning(n.pruneKeep)
 	n.state = state
 
-	fmt.Println("Blockchain state:")
-	fmt.Printf("- height: %d\n", n.state.LastBlock().Header.Number)
-	fmt.Printf("- hash: %s\n", n.state.LatestBlockHash().Hex())
+	err = state.Prune()
+	if err != nil {
+		n.logger.Error("Unable to prune block bodies", "err", err)
+	}
 
-	go n.sync(ctx)
-	go n.mine(ctx)
+	n.webhooks, err = loadWebhookRegistry(n.dataDir)
+	if err != nil {
+		return err
+	}
+
+	n.logger.Info("Loaded blockchain state", "height", n.state.LastBlock().Header.Number, "hash", n.state.LatestBlockHash().Hex(), "archive", n.archive, "lowest_full_block", n.state.LowestFullBlock())
+
+	// The loops must have stopped, along with any block they were adding,
+	// before the deferred state.Close runs
+	ctx, stopLoops := context.WithCancel(ctx)
+	var loops sync.WaitGroup
+	defer func() {
+		stopLoops()
+		loops.Wait()
+		n.logger.Info("Node stopped")
+	}()
+
+	loops.Add(4)
+	go func() {
+		defer loops.Done()
+		n.sync(ctx)
+	}()
+	go func() {
+		defer loops.Done()
+		n.mine(ctx)
+	}()
+	go func() {
+		defer loops.Done()
+		n.publishPendingTXs(ctx)
+	}()
+	go func() {
+		defer loops.Done()
+		n.deliverWebhooks(ctx)
+	}()
 
 	handler := http.NewServeMux()
 
@@ -97,6 +306,10 @@ func (n *Node) Run(ctx context.Context) error {
 		listBalancesHandler(w, r, state)
 	})
 
+	handler.HandleFunc(balanceEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		balanceHandler(w, r, n)
+	})
+
 	handler.HandleFunc(statusEndpoint, func(w http.ResponseWriter, r *http.Request) {
 		statusHandler(w, r, n)
 	})
@@ -105,27 +318,69 @@ func (n *Node) Run(ctx context.Context) error {
 		txAddHandler(w, r, n)
 	})
 
+	handler.HandleFunc(addSignedTXEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		txAddSignedHandler(w, r, n)
+	})
+
+	handler.HandleFunc(nonceEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		nonceHandler(w, r, n)
+	})
+
+	handler.HandleFunc(verifyMessageEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		verifyMessageHandler(w, r)
+	})
+
 	handler.HandleFunc(syncEndpoint, func(w http.ResponseWriter, r *http.Request) {
 		syncHandler(w, r, n)
 	})
 
+	handler.HandleFunc(eventsEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		eventsHandler(w, r, n)
+	})
+
+	handler.HandleFunc(webhooksEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		webhooksHandler(w, r, n)
+	})
+
+	handler.HandleFunc(webhookEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		webhookHandler(w, r, n)
+	})
+
 	handler.HandleFunc(addPeerEndpoint, func(w http.ResponseWriter, r *http.Request) {
 		addPeerHandler(w, r, n)
 	})
 
-	server := &http.Server{Addr: fmt.Sprintf(":%d", n.info.Port), Handler: handler}
+	handler.HandleFunc(metricsEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		metricsHandler(w, r, n)
+	})
+
+	handler.HandleFunc(healthzEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		healthzHandler(w, r, n)
+	})
+
+	handler.HandleFunc(readyzEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		readyzHandler(w, r, n)
+	})
+
+	server := &http.Server{Addr: n.httpAddr, Handler: n.instrument(handler)}
 
+	serverErr := make(chan error, 1)
 	go func() {
-		<-ctx.Done()
-		_ = server.Close()
+		serverErr <- server.ListenAndServe()
 	}()
 
-	err = server.ListenAndServe()
-	if err != http.ErrServerClosed {
+	select {
+	case err = <-serverErr:
 		return err
+	case <-ctx.Done():
 	}
 
-	return nil
+	n.logger.Info("Shutting down, draining HTTP requests, sync and mining")
+	n.events.close()
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancelShutdown()
+
+	return server.Shutdown(shutdownCtx)
 }
 
 func (n *Node) LatestBlockHash() database.Hash {
@@ -136,19 +391,28 @@ func (n *Node) mine(ctx context.Context) error {
 	var miningCtx context.Context
 	var stopCurrentMining context.CancelFunc
 
-	ticker := time.NewTicker(time.Second * miningIntervalInSeconds)
+	interval := n.miningConfig.Interval
+	if n.miningConfig.Policy == MiningPolicyAlways {
+		interval = alwaysMiningPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	var rounds sync.WaitGroup
 
 	for {
 		select {
 		case <-ticker.C:
+			rounds.Add(1)
 			go func() {
-				if len(n.pendingTXs) > 0 && !n.isMining {
+				defer rounds.Done()
+
+				if n.shouldMine() {
 					n.isMining = true
 
 					miningCtx, stopCurrentMining = context.WithCancel(ctx)
 					err := n.minePendingTXs(miningCtx)
-					if err != nil {
-						fmt.Printf("ERROR: %s\n", err)
+					if err != nil && miningCtx.Err() == nil {
+						n.minerLog.Error("Failed to mine block", "err", err)
 					}
 
 					n.isMining = false
@@ -157,49 +421,70 @@ func (n *Node) mine(ctx context.Context) error {
 		case block := <-n.newSyncedBlocks:
 			if n.isMining {
 				blockHash, _ := block.Hash()
-				fmt.Printf("\nPeer mined next block '%s' faster\n", blockHash.Hex())
+				n.minerLog.Info("Peer mined next block faster", "number", block.Header.Number, "hash", blockHash.Hex())
 				n.removeMinedPendingTXs(block)
 				stopCurrentMining()
 			}
 		case <-ctx.Done():
 			ticker.Stop()
+			rounds.Wait()
 			return nil
 		}
 	}
 }
 
+func (n *Node) shouldMine() bool {
+	if !n.IsSynced() || n.isMining {
+		return false
+	}
+
+	lastBlockTime := time.Unix(int64(n.state.LastBlock().Header.Time), 0)
+	if !n.state.LatestBlockHash().IsEmpty() && time.Since(lastBlockTime) < n.miningConfig.MinBlockInterval {
+		return false
+	}
+
+	switch n.miningConfig.Policy {
+	case MiningPolicyAlways, MiningPolicySchedule:
+		return true
+	default:
+		pending, _ := n.countTXs()
+		return pending > 0
+	}
+}
+
 func (n *Node) minePendingTXs(ctx context.Context) error {
+	number := n.state.LastBlock().Header.Number + 1
 	blockToMine := NewPendingBlock(
 		n.state.LatestBlockHash(),
-		n.state.LastBlock().Header.Number+1,
+		number,
 		n.info.Account,
-		n.getPendingTXsAsArray(),
-	)
+		n.getPendingTXsForBlock(number),
+	).WithVersion(n.state.BlockEncodingVersion(number))
 
-	minedBlock, err := Mine(ctx, blockToMine)
+	minedBlock, stats, err := MineParallel(ctx, blockToMine, n.miningConfig.Threads, n.minerLog)
+	n.metrics.recordMining(stats, err == nil)
 	if err != nil {
 		return err
 	}
 
-	n.removeMinedPendingTXs(minedBlock)
-
 	_, err = n.state.AddBlock(minedBlock)
 	if err != nil {
 		return err
 	}
+	n.removeMinedPendingTXs(minedBlock)
+	n.publishBlock(minedBlock)
 
 	return nil
 }
 
 func (n *Node) removeMinedPendingTXs(block database.Block) {
-	if len(block.TXs) > 0 && len(n.pendingTXs) > 0 {
-		fmt.Println("Updating in-memory pending TX pool:")
-	}
+	n.txsMu.Lock()
+	defer n.txsMu.Unlock()
 
 	for _, tx := range block.TXs {
 		txHash, _ := tx.Hash()
 		if _, exists := n.pendingTXs[txHash.Hex()]; exists {
-			fmt.Printf("- archiving mined TX:%s\n", txHash.Hex())
+			n.mempoolLog.Debug("Archiving mined TX", "tx", txHash.Hex(), "block", block.Header.Number)
 			n.archivedTXs[txHash.Hex()] = tx
 			delete(n.pendingTXs, txHash.Hex())
 		}
@@ -207,10 +492,16 @@ func (n *Node) removeMinedPendingTXs(block database.Block) {
 }
 
 func (n *Node) AddPeer(peer PeerNode) {
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
 	n.knownPeers[peer.TcpAddress()] = peer
 }
 
 func (n *Node) RemovePeer(peer PeerNode) {
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
 	delete(n.knownPeers, peer.TcpAddress())
 }
 
@@ -219,34 +510,102 @@ func (n *Node) IsKnownPeer(peer PeerNode) bool {
 		return true
 	}
 
+	n.peersMu.RLock()
+	defer n.peersMu.RUnlock()
+
 	_, isKnownPeer := n.knownPeers[peer.TcpAddress()]
 	return isKnownPeer
 }
 
-func (n *Node) AddPendingTX(tx database.SignedTx, fromPeer PeerNode) error {
-	txHash, err := tx.Hash()
-	if err != nil {
-		return err
+// getKnownPeers returns a copy of the known peers, safe to use while peers
+// are added or removed
+func (n *Node) getKnownPeers() map[string]PeerNode {
+	n.peersMu.RLock()
+	defer n.peersMu.RUnlock()
+
+	peers := make(map[string]PeerNode, len(n.knownPeers))
+	for address, peer := range n.knownPeers {
+		peers[address] = peer
 	}
 
-	txJson, err := json.Marshal(tx)
+	return peers
+}
+
+func (n *Node) AddPendingTX(tx database.SignedTx, fromPeer PeerNode) error {
+	txHash, err := tx.Hash()
 	if err != nil {
 		return err
 	}
 
+	n.txsMu.Lock()
 	_, isAlreadyPending := n.pendingTXs[txHash.Hex()]
 	_, isArchived := n.archivedTXs[txHash.Hex()]
 
-	if !isAlreadyPending && !isArchived {
-		fmt.Printf("Adding Pending TX %s from Peer %s\n", txJson, fromPeer.TcpAddress())
+	isNew := !isAlreadyPending && !isArchived
+	if isNew {
+		n.mempoolLog.Debug("Adding pending TX", "tx", txHash.Hex(), "from", tx.From.Hex(), "to", tx.To.Hex(), "value", tx.Value, "peer", fromPeer.TcpAddress())
 		n.pendingTXs[txHash.Hex()] = tx
+	}
+	n.txsMu.Unlock()
+
+	if isNew {
 		n.newPendingTXs <- tx
 	}
 
 	return nil
 }
 
+// validatePendingTX checks a TX submitted to the node can be mined after the
+// sender's pending TXs, so that a bad submission can't invalidate the block
+// it ends up in along with the TXs bundled with it
+func (n *Node) validatePendingTX(tx database.SignedTx) error {
+	nonce, pendingCost := n.getPendingTXsOf(tx.From)
+	if tx.Nonce != nonce {
+		return fmt.Errorf("wrong Tx, sender '%s' next nonce must be '%d', not '%d'", tx.From.String(), nonce, tx.Nonce)
+	}
+
+	txCost := tx.Value + database.TxGasFee
+	if balance := n.state.Balances[tx.From]; pendingCost+txCost > balance {
+		return fmt.Errorf("insufficient balance. Sender '%s' balance is %d TBS, its pending TXs cost %d TBS. Tx cost is %d TBS", tx.From.String(), balance, pendingCost, txCost)
+	}
+
+	return nil
+}
+
+// getPendingTXsOf returns the next nonce of the account once its pending TXs
+// are mined, and how much those TXs cost
+func (n *Node) getPendingTXsOf(account common.Address) (uint, uint) {
+	n.txsMu.RLock()
+	defer n.txsMu.RUnlock()
+
+	nonce := n.state.GetNextAccountNonce(account)
+	cost := uint(0)
+	for _, tx := range n.pendingTXs {
+		if tx.From != account || tx.Nonce < n.state.GetNextAccountNonce(account) {
+			continue
+		}
+
+		cost += tx.Value + database.TxGasFee
+		if tx.Nonce >= nonce {
+			nonce = tx.Nonce + 1
+		}
+	}
+
+	return nonce, cost
+}
+
+// countTXs returns the number of pending and archived TXs
+func (n *Node) countTXs() (int, int) {
+	n.txsMu.RLock()
+	defer n.txsMu.RUnlock()
+
+	return len(n.pendingTXs), len(n.archivedTXs)
+}
+
 func (n *Node) getPendingTXsAsArray() []database.SignedTx {
+	n.txsMu.RLock()
+	defer n.txsMu.RUnlock()
+
 	txs := make([]database.SignedTx, len(n.pendingTXs))
 
 	i := 0
@@ -257,3 +616,39 @@ func (n *Node) getPendingTXsAsArray() []database.SignedTx {
 
 	return txs
 }
+
+// getPendingTXsForBlock returns the oldest pending TXs, at most
+// MaxTXsPerBlock of them. Blocks apply their TXs in time order, which only has
+// a one second resolution, so TXs of the same second are ordered by sender and
+// nonce for the TXs of a sender to follow their nonces. Legacy JSON TXs are
+// left out of blocks which must use the canonical encoding.
+func (n *Node) getPendingTXsForBlock(number uint64) []database.SignedTx {
+	n.txsMu.RLock()
+	txs := make([]database.SignedTx, 0, len(n.pendingTXs))
+	for _, tx := range n.pendingTXs {
+		if tx.Version < n.state.BlockEncodingVersion(number) {
+			continue
+		}
+
+		txs = append(txs, tx)
+	}
+	n.txsMu.RUnlock()
+
+	sort.Slice(txs, func(i, j int) bool {
+		if txs[i].Time != txs[j].Time {
+			return txs[i].Time < txs[j].Time
+		}
+
+		if txs[i].From != txs[j].From {
+			return bytes.Compare(txs[i].From.Bytes(), txs[j].From.Bytes()) < 0
+		}
+
+		return txs[i].Nonce < txs[j].Nonce
+	})
+
+	if n.miningConfig.MaxTXsPerBlock > 0 && len(txs) > n.miningConfig.MaxTXsPerBlock {
+		txs = txs[:n.miningConfig.MaxTXsPerBlock]
+	}
+
+	return txs
+}
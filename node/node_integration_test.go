@@ -2,7 +2,6 @@ package node
 
 import (
 	"context"
-	"encoding/json"
 	"io"
 	"io/ioutil"
 	"os"
@@ -29,21 +28,17 @@ const testKsJTangPwd = "jtang"
 const testKsQudsiiPwd = "qudsii"
 
 func TestNode_Run(t *testing.T) {
-	dataDir, err := getTestDataDirPath()
-	if err != nil {
-		t.Fatalf("unexpected error when getting test data directory: %s", err)
-	}
-
-	err = fs.RemoveDir(dataDir)
+	dataDir, _, _, err := setupTestNodeDir(t, 1000000)
+	defer teardownTestNodeDir(dataDir)
 	if err != nil {
-		t.Fatalf("unexpected error when removing test directory: %s", err)
+		t.Fatalf("error setting up test node directory. %s", err.Error())
 	}
 
 	n := NewNode(dataDir, "127.0.0.1", 8085, database.NewAccount(DefaultMiner), PeerNode{})
 	ctx, _ := context.WithTimeout(context.Background(), time.Second*5)
 	err = n.Run(ctx)
-	if err.Error() != "http: Server closed" {
-		t.Fatalf("node server expected to close after 5s but did not")
+	if err != nil {
+		t.Fatalf("node server expected to shut down cleanly after 5s, got: %s", err.Error())
 	}
 }
 
@@ -182,8 +177,9 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 	}()
 
 	go func() {
-		time.Sleep(time.Second * (miningIntervalInSeconds + 2))
-		if !n.isMining {
+		// The synced block must arrive while toshi is mining both TXs, which
+		// with several mining threads might not take the whole interval
+		if !waitUntil(func() bool { return n.isMining }, time.Second*(miningIntervalInSeconds+2)) {
 			t.Fatalf("toshi should be mining but is not")
 		}
 
@@ -205,8 +201,7 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 			t.Fatalf("toshi should have cancelled mining of already mined TX")
 		}
 
-		time.Sleep(time.Second * (miningIntervalInSeconds + 2))
-		if !n.isMining {
+		if !waitUntil(func() bool { return n.isMining || n.state.LastBlock().Header.Number == 1 }, time.Second*(miningIntervalInSeconds+2)) {
 			t.Fatalf("toshi should be mining the single tx not in synced block")
 		}
 	}()
@@ -237,15 +232,17 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 		accOneEndBal := n.state.Balances[toshi]
 		accTwoEndBal := n.state.Balances[jtang]
 
-		accOneExpectedEndBal := accOneStartBal - tx1.Value - tx2.Value + database.BlockReward
-		accTwoExpectedEndBal := accTwoStartBal + tx1.Value + tx2.Value + database.BlockReward
+		// Each miner is rewarded with the block reward and the fee of the
+		// single TX in their block, tx1 can't be replayed in toshi's block
+		accOneExpectedEndBal := accOneStartBal - tx1.Value - tx2.Value - 2*database.TxGasFee + database.BlockReward + database.TxGasFee
+		accTwoExpectedEndBal := accTwoStartBal + tx1.Value + tx2.Value + database.BlockReward + database.TxGasFee
 
 		if accOneEndBal != accOneExpectedEndBal {
 			t.Fatalf("expected toshi to have %d balance, not %d", accOneExpectedEndBal, accOneEndBal)
 		}
 
 		if accTwoEndBal != accTwoExpectedEndBal {
-			t.Fatalf("expected jtang to have %d balance, not %d", accOneExpectedEndBal, accOneEndBal)
+			t.Fatalf("expected jtang to have %d balance, not %d", accTwoExpectedEndBal, accTwoEndBal)
 		}
 
 		t.Logf("Starting toshi balance: %d", accOneStartBal)
@@ -455,6 +452,19 @@ func TestNode_MiningSpamTransaction(t *testing.T) {
 	t.Logf("miner final balance: %d", n.state.Balances[miner])
 }
 
+// waitUntil polls the condition until it holds or the timeout elapses
+func waitUntil(condition func() bool, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return condition()
+}
+
 func getTestDataDirPath() (string, error) {
 	return ioutil.TempDir(os.TempDir(), ".tbs_test")
 }
@@ -466,11 +476,6 @@ func setupTestNodeDir(t *testing.T, toshiAccBalance uint) (dataDir string, toshi
 	genesisBalances := make(map[common.Address]uint)
 	genesisBalances[toshi] = toshiAccBalance
 	genesis := database.Genesis{Balances: genesisBalances}
-	genesisJson, err := json.Marshal(genesis)
-	if err != nil {
-		t.Logf("unexpected error when creating test genesis: %s", err.Error())
-		return "", common.Address{}, common.Address{}, err
-	}
 
 	dataDir, err = getTestDataDirPath()
 	if err != nil {
@@ -478,7 +483,7 @@ func setupTestNodeDir(t *testing.T, toshiAccBalance uint) (dataDir string, toshi
 		return "", common.Address{}, common.Address{}, err
 	}
 
-	err = database.InitDataDirIfNotExists(dataDir, genesisJson)
+	err = database.InitDataDir(dataDir, genesis)
 	if err != nil {
 		t.Logf("unexpected error when initialising dataDir: %s", err)
 		return "", common.Address{}, common.Address{}, err
@@ -0,0 +1,146 @@
+package node
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const DefaultMinPeers = 3
+const seedResolveTimeout = 5 * time.Second
+
+// reseed tops up the known peers from the bootstrap peers and the seed file
+// whenever the node knows fewer than its minimum. Candidates are tried in a
+// random order so that nodes don't all pile onto the first bootstrap peer.
+func (n *Node) reseed(ctx context.Context) {
+	if n.countKnownPeers() >= n.minPeers {
+		return
+	}
+
+	candidates := n.seedCandidates(ctx)
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	random.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	for _, peer := range candidates {
+		if n.countKnownPeers() >= n.minPeers {
+			return
+		}
+
+		if n.IsKnownPeer(peer) {
+			continue
+		}
+
+		n.syncLog.Info("Seeding peer into KnownPeers", "peer", peer.TcpAddress())
+		n.AddPeer(peer)
+	}
+}
+
+func (n *Node) countKnownPeers() int {
+	n.peersMu.RLock()
+	defer n.peersMu.RUnlock()
+
+	count := 0
+	for _, peer := range n.knownPeers {
+		if peer.IP == n.info.IP && peer.Port == n.info.Port {
+			continue
+		}
+
+		count++
+	}
+
+	return count
+}
+
+func (n *Node) seedCandidates(ctx context.Context) []PeerNode {
+	candidates := make([]PeerNode, len(n.bootstraps))
+	copy(candidates, n.bootstraps)
+
+	if n.seedFile == "" {
+		return candidates
+	}
+
+	seeds, err := loadSeedFile(n.seedFile)
+	if err != nil {
+		n.syncLog.Error("Failed to load seed file", "err", err)
+		return candidates
+	}
+
+	for _, seed := range seeds {
+		peers, err := resolveSeed(ctx, seed)
+		if err != nil {
+			n.syncLog.Warn("Failed to resolve seed", "seed", seed, "err", err)
+			continue
+		}
+
+		candidates = append(candidates, peers...)
+	}
+
+	return candidates
+}
+
+// loadSeedFile reads a seed file of host:port or account@host:port lines,
+// ignoring blank lines and # comments
+func loadSeedFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open seed file '%s'. %s", path, err.Error())
+	}
+	defer f.Close()
+
+	seeds := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		seeds = append(seeds, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read seed file '%s'. %s", path, err.Error())
+	}
+
+	return seeds, nil
+}
+
+// resolveSeed turns a seed into peers, a DNS name resolves to one peer for
+// every IPv4 address it points to
+func resolveSeed(ctx context.Context, seed string) ([]PeerNode, error) {
+	peer, err := ParsePeerNode(seed, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if net.ParseIP(peer.IP) != nil {
+		return []PeerNode{peer}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, seedResolveTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, peer.IP)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve seed '%s'. %s", seed, err.Error())
+	}
+
+	peers := make([]PeerNode, 0, len(addrs))
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil || ip.To4() == nil {
+			continue
+		}
+
+		peers = append(peers, NewPeerNode(ip.String(), peer.Port, true, peer.Account, false))
+	}
+
+	return peers, nil
+}
@@ -0,0 +1,66 @@
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jTanG0506/go-blockchain/database"
+)
+
+func TestReseed(t *testing.T) {
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatalf("unexpected error when getting test data directory: %s", err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	seedFile := filepath.Join(dataDir, "seeds.txt")
+	seeds := "# seeds\n127.0.0.1:9001\n\n" + testKsJTangAccount + "@127.0.0.1:9002\n127.0.0.1:9003\n"
+	err = ioutil.WriteFile(seedFile, []byte(seeds), 0644)
+	if err != nil {
+		t.Fatalf("unable to write seed file. %s", err.Error())
+	}
+
+	bootstrap := NewPeerNode("127.0.0.1", 9000, true, database.NewAccount(testKsToshiAccount), false)
+	n := NewNode(dataDir, "127.0.0.1", 8085, database.NewAccount(DefaultMiner), bootstrap)
+	n.SetSeedFile(seedFile)
+	n.SetMinPeers(3)
+
+	n.reseed(context.Background())
+	if n.countKnownPeers() != 3 {
+		t.Fatalf("expected 3 known peers after re-seeding, got %d", n.countKnownPeers())
+	}
+
+	n.RemovePeer(bootstrap)
+	n.reseed(context.Background())
+	if n.countKnownPeers() != 3 {
+		t.Fatalf("expected re-seeding to replace the removed peer, got %d known peers", n.countKnownPeers())
+	}
+
+	n.SetMinPeers(10)
+	n.reseed(context.Background())
+	if n.countKnownPeers() != 4 {
+		t.Fatalf("expected every bootstrap peer and seed to be known, got %d known peers", n.countKnownPeers())
+	}
+}
+
+func TestParsePeerNode(t *testing.T) {
+	peer, err := ParsePeerNode(testKsToshiAccount+"@10.0.0.1:8080", true)
+	if err != nil {
+		t.Fatalf("unable to parse peer. %s", err.Error())
+	}
+
+	if peer.IP != "10.0.0.1" || peer.Port != 8080 || peer.Account != database.NewAccount(testKsToshiAccount) || !peer.IsBootstrap {
+		t.Fatalf("peer parsed incorrectly: %+v", peer)
+	}
+
+	for _, invalid := range []string{"10.0.0.1", "nope@10.0.0.1:8080", "10.0.0.1:port", "10.0.0.1:99999"} {
+		_, err := ParsePeerNode(invalid, true)
+		if err == nil {
+			t.Fatalf("expected '%s' to be an invalid peer", invalid)
+		}
+	}
+}
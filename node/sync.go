@@ -4,113 +4,417 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/jTanG0506/go-blockchain/database"
 )
 
+const syncIntervalInSeconds = 10
+const DefaultSyncInterval = syncIntervalInSeconds * time.Second
+const syncRequestTimeout = 10 * time.Second
+const syncBlocksBatchSize = 100
+const syncMaxConcurrentFetches = 4
+
+type SyncState string
+
+const (
+	// SyncStateDiscovering is the state of a node which hasn't yet heard from
+	// its peers and so doesn't know how far behind it might be.
+	SyncStateDiscovering SyncState = "discovering"
+	SyncStateCatchingUp  SyncState = "catching-up"
+	SyncStateSynced      SyncState = "synced"
+)
+
+type peerStatus struct {
+	peer   PeerNode
+	status StatusRes
+	err    error
+}
+
+type blocksBatch struct {
+	offset uint64
+	limit  uint64
+	peer   PeerNode
+	blocks []database.Block
+	err    error
+}
+
 func (n *Node) sync(ctx context.Context) error {
-	ticker := time.NewTicker(10 * time.Second)
+	ticker := time.NewTicker(n.syncInterval)
+
+	// Sync straight away rather than after the first tick so that a node
+	// without any peers can leave the discovering state and start mining.
+	n.doSync(ctx)
 
 	for {
 		select {
 		case <-ticker.C:
-			n.doSync()
+			n.doSync(ctx)
 		case <-ctx.Done():
 			ticker.Stop()
+			return nil
 		}
 	}
 }
 
-func (n *Node) doSync() {
-	for _, peer := range n.knownPeers {
-		if peer.IP == n.info.IP && peer.Port == n.info.Port {
-			continue
-		}
+func (n *Node) doSync(ctx context.Context) {
+	n.reseed(ctx)
+	statuses := n.queryPeerStatuses(ctx)
 
-		if peer.IP == "" {
+	reachable := make([]peerStatus, 0, len(statuses))
+	for _, ps := range statuses {
+		if ps.err != nil {
+			n.syncLog.Warn("Removing unreachable peer from KnownPeers", "peer", ps.peer.TcpAddress(), "err", ps.err)
+			n.RemovePeer(ps.peer)
 			continue
 		}
 
-		fmt.Printf("Searching for new peers and their blocks and peers: %s\n", peer.TcpAddress())
-
-		status, err := queryPeerStatus(peer)
+		err := n.joinKnownPeers(ctx, ps.peer)
 		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
-			fmt.Printf("Removing peer '%s' from KnownPeers\n", peer.TcpAddress())
-			n.RemovePeer(peer)
+			n.syncLog.Error("Failed to join peer", "peer", ps.peer.TcpAddress(), "err", err)
 			continue
 		}
 
-		err = n.joinKnownPeers(peer)
+		reachable = append(reachable, ps)
+	}
+
+	n.updateSyncState(statuses)
+
+	err := n.syncBlocks(ctx, reachable)
+	if err != nil {
+		n.syncLog.Error("Failed to sync blocks", "err", err)
+	}
+
+	n.updateSyncState(statuses)
+
+	for _, ps := range reachable {
+		err = n.syncKnownPeers(ps.status)
 		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
+			n.syncLog.Error("Failed to sync known peers", "peer", ps.peer.TcpAddress(), "err", err)
 			continue
 		}
 
-		err = n.syncBlocks(peer, status)
+		err = n.syncPendingTXs(ps.peer, ps.status.PendingTXs)
 		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
+			n.syncLog.Error("Failed to sync pending TXs", "peer", ps.peer.TcpAddress(), "err", err)
 			continue
 		}
+	}
+}
 
-		err = n.syncKnownPeers(status)
-		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
+// queryPeerStatuses asks every known peer for its status concurrently so a
+// single slow peer cannot hold up the whole sync round.
+func (n *Node) queryPeerStatuses(ctx context.Context) []peerStatus {
+	knownPeers := n.getKnownPeers()
+	peers := make([]PeerNode, 0, len(knownPeers))
+	for _, peer := range knownPeers {
+		if peer.IP == n.info.IP && peer.Port == n.info.Port {
 			continue
 		}
 
-		err = n.syncPendingTXs(peer, status.PendingTXs)
-		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
+		if peer.IP == "" {
 			continue
 		}
+
+		peers = append(peers, peer)
+	}
+
+	statuses := make([]peerStatus, len(peers))
+	var wg sync.WaitGroup
+
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer PeerNode) {
+			defer wg.Done()
+
+			n.syncLog.Debug("Querying peer status", "peer", peer.TcpAddress())
+			status, err := queryPeerStatus(ctx, peer)
+			statuses[i] = peerStatus{peer, status, err}
+		}(i, peer)
 	}
+
+	wg.Wait()
+	return statuses
 }
 
-func (n *Node) syncBlocks(peer PeerNode, status StatusRes) error {
+// syncBlocks downloads the blocks this node is missing in batches of
+// syncBlocksBatchSize, fetching up to syncMaxConcurrentFetches batches at once
+// from the peers that are ahead of us and applying them in order.
+func (n *Node) syncBlocks(ctx context.Context, statuses []peerStatus) error {
 	localBlockNumber := n.state.LastBlock().Header.Number
+	hasLocalBlocks := !n.state.LatestBlockHash().IsEmpty()
 
-	if status.Hash.IsEmpty() {
-		return nil
-	}
+	sources := make([]PeerNode, 0)
+	bestNumber := uint64(0)
+	for _, ps := range statuses {
+		if !isPeerAhead(ps.status, localBlockNumber, hasLocalBlocks) {
+			continue
+		}
 
-	if status.Number < localBlockNumber {
-		return nil
+		if !canPeerServe(ps.status, localBlockNumber, hasLocalBlocks) {
+			n.syncLog.Debug("Skipping pruned peer", "peer", ps.peer.TcpAddress(), "lowest_full_block", ps.status.LowestFullBlock)
+			continue
+		}
+
+		sources = append(sources, ps.peer)
+		if ps.status.Number > bestNumber {
+			bestNumber = ps.status.Number
+		}
 	}
 
-	if status.Number == 0 && !n.state.LatestBlockHash().IsEmpty() {
+	if len(sources) == 0 {
 		return nil
 	}
 
-	// Display found 1 new block if syncing the genesis block 0
-	newBlocksCount := status.Number - localBlockNumber
-	if localBlockNumber == 0 && status.Number == 0 {
-		newBlocksCount = 1
+	heights := peerHeights(statuses)
+	firstNumber := localBlockNumber + 1
+	batches := make([]*blocksBatch, 0)
+
+	// A chain starts at block 0 or 1, so without local blocks the number of
+	// the first block missing is only known once the first batch is fetched
+	if !hasLocalBlocks {
+		batches = append(batches, &blocksBatch{limit: n.syncBatchSize, peer: sources[0]})
+		fetchBlocksBatches(ctx, n.syncLog, database.Hash{}, batches)
+
+		firstNumber = 0
+		if len(batches[0].blocks) > 0 {
+			firstNumber = batches[0].blocks[0].Header.Number
+		}
 	}
-	fmt.Printf("Found %d new blocks from peer '%s'\n", newBlocksCount, peer.TcpAddress())
 
-	blocks, err := fetchBlocksFromPeer(peer, n.state.LatestBlockHash())
-	if err != nil {
-		return err
+	if bestNumber < firstNumber {
+		return nil
 	}
 
-	for _, block := range blocks {
-		_, err = n.state.AddBlock(block)
+	newBlocksCount := bestNumber - firstNumber + 1
+	n.syncLog.Info("Found new blocks", "count", newBlocksCount, "peers", len(sources))
+
+	start := time.Now()
+	synced := uint64(0)
+
+	for synced < newBlocksCount {
+		// Every round is anchored at our current tip, so its batches can be
+		// fetched in parallel and still describe one contiguous chain
+		if len(batches) == 0 {
+			batches = planBlocksBatches(newBlocksCount-synced, firstNumber+synced, n.syncBatchSize, sources, heights)
+			if len(batches) == 0 {
+				return fmt.Errorf("no peer can serve blocks from block %d", firstNumber+synced)
+			}
+
+			fetchBlocksBatches(ctx, n.syncLog, n.state.LatestBlockHash(), batches)
+		}
+
+		applied, err := n.applyBlocksBatches(ctx, batches, newBlocksCount-synced)
+		synced += applied
 		if err != nil {
 			return err
 		}
 
-		n.newSyncedBlocks <- block
+		logSyncProgress(n.syncLog, synced, newBlocksCount, time.Since(start))
+		batches = nil
 	}
 
 	return nil
 }
 
+// applyBlocksBatches adds the blocks of the batches in order and returns how
+// many were added. It stops after a batch shorter than expected, as the
+// blocks of the batches after it no longer follow our tip.
+func (n *Node) applyBlocksBatches(ctx context.Context, batches []*blocksBatch, remaining uint64) (uint64, error) {
+	applied := uint64(0)
+	for _, batch := range batches {
+		if batch.err != nil {
+			return applied, fmt.Errorf("unable to fetch blocks from peer '%s'. %s", batch.peer.TcpAddress(), batch.err.Error())
+		}
+
+		if len(batch.blocks) == 0 {
+			return applied, fmt.Errorf("peer '%s' returned no blocks at offset %d", batch.peer.TcpAddress(), batch.offset)
+		}
+
+		for _, block := range batch.blocks {
+			_, err := n.state.AddBlock(block)
+			if err != nil {
+				return applied, err
+			}
+			n.publishBlock(block)
+
+			select {
+			case n.newSyncedBlocks <- block:
+			case <-ctx.Done():
+				return applied, ctx.Err()
+			}
+			applied++
+		}
+
+		expected := batch.limit
+		if remaining-batch.offset < expected {
+			expected = remaining - batch.offset
+		}
+
+		if uint64(len(batch.blocks)) < expected {
+			n.syncLog.Debug("Peer returned fewer blocks than requested", "peer", batch.peer.TcpAddress(), "offset", batch.offset, "blocks", len(batch.blocks), "expected", expected)
+			return applied, nil
+		}
+	}
+
+	return applied, nil
+}
+
+// updateSyncState compares our tip against the best height reported by the
+// peers we just heard from. A node without any peer to ask has nobody to
+// catch up with and is considered synced, but when every peer is unreachable
+// the state is left as is, so a node never leaves the discovering state
+// before it heard from a peer.
+func (n *Node) updateSyncState(statuses []peerStatus) {
+	localBlockNumber := n.state.LastBlock().Header.Number
+	hasLocalBlocks := !n.state.LatestBlockHash().IsEmpty()
+
+	bestNumber := localBlockNumber
+	isBehind := false
+	heard := false
+	for _, ps := range statuses {
+		if ps.err != nil {
+			continue
+		}
+		heard = true
+
+		if ps.status.Number > bestNumber {
+			bestNumber = ps.status.Number
+		}
+
+		if isPeerAhead(ps.status, localBlockNumber, hasLocalBlocks) {
+			isBehind = true
+		}
+	}
+
+	if len(statuses) > 0 && !heard {
+		n.syncLog.Debug("No peer reachable, keeping sync state", "state", n.SyncState())
+		return
+	}
+
+	state := SyncStateSynced
+	if isBehind {
+		state = SyncStateCatchingUp
+	}
+
+	n.syncMu.Lock()
+	defer n.syncMu.Unlock()
+
+	if n.syncState != state {
+		n.syncLog.Info("Sync state changed", "from", n.syncState, "to", state, "best_peer_number", bestNumber)
+	}
+
+	n.syncState = state
+	n.bestPeerNumber = bestNumber
+}
+
+func (n *Node) SyncState() SyncState {
+	n.syncMu.RLock()
+	defer n.syncMu.RUnlock()
+
+	return n.syncState
+}
+
+func (n *Node) IsSynced() bool {
+	return n.SyncState() == SyncStateSynced
+}
+
+// BestPeerNumber is the highest block number reported by any peer during the
+// last sync round, or our own height if no peer is ahead of us.
+func (n *Node) BestPeerNumber() uint64 {
+	n.syncMu.RLock()
+	defer n.syncMu.RUnlock()
+
+	return n.bestPeerNumber
+}
+
+func isPeerAhead(status StatusRes, localBlockNumber uint64, hasLocalBlocks bool) bool {
+	if status.Hash.IsEmpty() {
+		return false
+	}
+
+	if !hasLocalBlocks {
+		return true
+	}
+
+	return status.Number > localBlockNumber
+}
+
+// canPeerServe tells whether the peer still has the TXs of the next block
+// needed, a pruned peer only serves blocks from its lowest full block
+func canPeerServe(status StatusRes, localBlockNumber uint64, hasLocalBlocks bool) bool {
+	next := uint64(0)
+	if hasLocalBlocks {
+		next = localBlockNumber + 1
+	}
+
+	return status.LowestFullBlock <= next
+}
+
+func peerHeights(statuses []peerStatus) map[string]uint64 {
+	heights := make(map[string]uint64)
+	for _, ps := range statuses {
+		heights[ps.peer.TcpAddress()] = ps.status.Number
+	}
+
+	return heights
+}
+
+// planBlocksBatches splits the next window of missing blocks, starting from
+// the block with the given number, into batches and assigns each batch, round
+// robin, to a peer tall enough to serve it.
+func planBlocksBatches(remaining, firstNumber, batchSize uint64, sources []PeerNode, heights map[string]uint64) []*blocksBatch {
+	batches := make([]*blocksBatch, 0, syncMaxConcurrentFetches)
+
+	for i := 0; i < syncMaxConcurrentFetches; i++ {
+		offset := uint64(i) * batchSize
+		if offset >= remaining {
+			break
+		}
+
+		for j := range sources {
+			peer := sources[(i+j)%len(sources)]
+			if heights[peer.TcpAddress()] >= firstNumber+offset {
+				batches = append(batches, &blocksBatch{offset: offset, limit: batchSize, peer: peer})
+				break
+			}
+		}
+	}
+
+	return batches
+}
+
+func fetchBlocksBatches(ctx context.Context, logger log.Logger, fromBlock database.Hash, batches []*blocksBatch) {
+	var wg sync.WaitGroup
+
+	for _, batch := range batches {
+		wg.Add(1)
+		go func(batch *blocksBatch) {
+			defer wg.Done()
+			logger.Debug("Importing blocks from peer", "offset", batch.offset, "limit", batch.limit, "peer", batch.peer.TcpAddress())
+			batch.blocks, batch.err = fetchBlocksFromPeer(ctx, batch.peer, fromBlock, batch.offset, batch.limit)
+		}(batch)
+	}
+
+	wg.Wait()
+}
+
+func logSyncProgress(logger log.Logger, synced, total uint64, elapsed time.Duration) {
+	rate := float64(synced) / elapsed.Seconds()
+	eta := time.Duration(0)
+	if rate > 0 {
+		eta = time.Duration(float64(total-synced)/rate) * time.Second
+	}
+
+	logger.Info("Synced blocks", "synced", synced, "total", total, "rate", fmt.Sprintf("%.2f blocks/s", rate), "eta", eta)
+}
+
 func (n *Node) syncKnownPeers(status StatusRes) error {
 	for _, statusPeer := range status.KnownPeers {
 		if !n.IsKnownPeer(statusPeer) {
-			fmt.Printf("Found a new peer %s\n", statusPeer.TcpAddress())
+			n.syncLog.Info("Found a new peer", "peer", statusPeer.TcpAddress())
 			n.AddPeer(statusPeer)
 		}
 	}
@@ -129,7 +433,7 @@ func (n *Node) syncPendingTXs(peer PeerNode, txs []database.SignedTx) error {
 	return nil
 }
 
-func (n *Node) joinKnownPeers(peer PeerNode) error {
+func (n *Node) joinKnownPeers(ctx context.Context, peer PeerNode) error {
 	if peer.IsActive {
 		return nil
 	}
@@ -144,7 +448,7 @@ func (n *Node) joinKnownPeers(peer PeerNode) error {
 		n.info.Port,
 	)
 
-	res, err := http.Get(url)
+	res, err := getWithTimeout(ctx, url)
 	if err != nil {
 		return err
 	}
@@ -158,7 +462,7 @@ func (n *Node) joinKnownPeers(peer PeerNode) error {
 		return fmt.Errorf(addPeerRes.Error)
 	}
 
-	knownPeer := n.knownPeers[peer.TcpAddress()]
+	knownPeer := n.getKnownPeers()[peer.TcpAddress()]
 	knownPeer.IsActive = addPeerRes.Success
 	n.AddPeer(knownPeer)
 
@@ -169,9 +473,9 @@ func (n *Node) joinKnownPeers(peer PeerNode) error {
 	return nil
 }
 
-func queryPeerStatus(peer PeerNode) (StatusRes, error) {
-	url := fmt.Sprintf("http://%s/%s", peer.TcpAddress(), statusEndpoint)
-	res, err := http.Get(url)
+func queryPeerStatus(ctx context.Context, peer PeerNode) (StatusRes, error) {
+	url := fmt.Sprintf("http://%s%s", peer.TcpAddress(), statusEndpoint)
+	res, err := getWithTimeout(ctx, url)
 	if err != nil {
 		return StatusRes{}, err
 	}
@@ -185,18 +489,20 @@ func queryPeerStatus(peer PeerNode) (StatusRes, error) {
 	return statusRes, nil
 }
 
-func fetchBlocksFromPeer(peer PeerNode, fromBlock database.Hash) ([]database.Block, error) {
-	fmt.Printf("Importing blocks from peer '%s'...\n", peer.TcpAddress())
-
+func fetchBlocksFromPeer(ctx context.Context, peer PeerNode, fromBlock database.Hash, offset, limit uint64) ([]database.Block, error) {
 	url := fmt.Sprintf(
-		"http://%s%s?%s=%s",
+		"http://%s%s?%s=%s&%s=%d&%s=%d",
 		peer.TcpAddress(),
 		syncEndpoint,
 		syncEndpointQueryKeyFromBlock,
 		fromBlock.Hex(),
+		syncEndpointQueryKeyOffset,
+		offset,
+		syncEndpointQueryKeyLimit,
+		limit,
 	)
 
-	res, err := http.Get(url)
+	res, err := getWithTimeout(ctx, url)
 	if err != nil {
 		return nil, err
 	}
@@ -209,3 +515,24 @@ func fetchBlocksFromPeer(peer PeerNode, fromBlock database.Hash) ([]database.Blo
 
 	return syncRes.Blocks, nil
 }
+
+// getWithTimeout performs a GET request which is abandoned after
+// syncRequestTimeout or as soon as the parent context is cancelled.
+func getWithTimeout(ctx context.Context, url string) (*http.Response, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, syncRequestTimeout)
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	res.Body = &cancelOnCloseBody{res.Body, cancel}
+	return res, nil
+}
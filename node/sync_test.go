@@ -0,0 +1,206 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/jTanG0506/go-blockchain/database"
+)
+
+func TestPlanBlocksBatches(t *testing.T) {
+	short := NewPeerNode("127.0.0.1", 8081, false, database.NewAccount("0x01"), true)
+	tall := NewPeerNode("127.0.0.1", 8082, false, database.NewAccount("0x02"), true)
+	heights := map[string]uint64{short.TcpAddress(): 12, tall.TcpAddress(): 40}
+
+	batches := planBlocksBatches(30, 11, 10, []PeerNode{short, tall}, heights)
+	if len(batches) != 3 {
+		t.Fatalf("expected 3 batches for 30 blocks, got %d", len(batches))
+	}
+
+	for i, batch := range batches {
+		if batch.offset != uint64(i)*10 || batch.limit != 10 {
+			t.Fatalf("expected batch %d at offset %d, got offset %d limit %d", i, i*10, batch.offset, batch.limit)
+		}
+
+		// The short peer only has the blocks of the first batch
+		if i > 0 && batch.peer != tall {
+			t.Fatalf("expected batch %d from block %d to be fetched from the tall peer", i, 11+batch.offset)
+		}
+	}
+}
+
+func TestSyncBlocks(t *testing.T) {
+	srcDir, toshi, _, err := setupTestNodeDir(t, 1000000)
+	defer teardownTestNodeDir(srcDir)
+	if err != nil {
+		t.Fatalf("error setting up test node directory. %s", err.Error())
+	}
+
+	src := NewNode(srcDir, "127.0.0.1", 8085, toshi)
+	src.state, err = database.NewStateFromDisk(srcDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+	defer src.state.Close()
+
+	// Numbered from 1 like the chain of a node mining from scratch
+	for number := uint64(1); number <= 3; number++ {
+		pb := NewPendingBlock(src.state.LatestBlockHash(), number, toshi, []database.SignedTx{}).WithVersion(src.state.BlockEncodingVersion(number))
+		block, _, err := MineParallel(context.Background(), pb, runtime.NumCPU(), log.Root())
+		if err != nil {
+			t.Fatalf("unable to mine block %d. %s", number, err.Error())
+		}
+
+		_, err = src.state.AddBlock(block)
+		if err != nil {
+			t.Fatalf("unable to add block %d. %s", number, err.Error())
+		}
+	}
+
+	status := StatusRes{Hash: src.state.LatestBlockHash(), Number: 3}
+
+	t.Run("parallel batches", func(t *testing.T) {
+		first, firstRequests := newTestSyncPeer(t, src, 0)
+		second, secondRequests := newTestSyncPeer(t, src, 0)
+
+		dst := newTestSyncNode(t, 1)
+		defer dst.state.Close()
+
+		err := dst.syncBlocks(context.Background(), []peerStatus{{peer: first, status: status}, {peer: second, status: status}})
+		if err != nil {
+			t.Fatalf("unable to sync blocks. %s", err.Error())
+		}
+
+		if dst.state.LatestBlockHash() != status.Hash {
+			t.Fatalf("expected to sync up to block 3, got block %d", dst.state.LastBlock().Header.Number)
+		}
+
+		// The first batch finds where the chain starts, the other two are
+		// fetched together from both peers
+		if atomic.LoadInt32(firstRequests) != 2 || atomic.LoadInt32(secondRequests) != 1 {
+			t.Fatalf("expected 2 and 1 requests to the peers, got %d and %d", *firstRequests, *secondRequests)
+		}
+	})
+
+	t.Run("short batches", func(t *testing.T) {
+		peer, requests := newTestSyncPeer(t, src, 1)
+
+		dst := newTestSyncNode(t, 2)
+		defer dst.state.Close()
+
+		err := dst.syncBlocks(context.Background(), []peerStatus{{peer: peer, status: status}})
+		if err != nil {
+			t.Fatalf("unable to sync blocks from a peer returning short batches. %s", err.Error())
+		}
+
+		if dst.state.LatestBlockHash() != status.Hash {
+			t.Fatalf("expected to sync up to block 3, got block %d", dst.state.LastBlock().Header.Number)
+		}
+
+		if atomic.LoadInt32(requests) != 3 {
+			t.Fatalf("expected a request per block, got %d", *requests)
+		}
+	})
+}
+
+// newTestSyncPeer serves the blocks of the node, capping the blocks per
+// request to maxLimit unless it's 0
+func newTestSyncPeer(t *testing.T, n *Node, maxLimit uint64) (PeerNode, *int32) {
+	requests := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+
+		if maxLimit > 0 {
+			query := r.URL.Query()
+			query.Set(syncEndpointQueryKeyLimit, strconv.FormatUint(maxLimit, 10))
+			r.URL.RawQuery = query.Encode()
+		}
+
+		syncHandler(w, r, n)
+	}))
+	t.Cleanup(server.Close)
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	portNumber, err := strconv.ParseUint(port, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewPeerNode(host, portNumber, false, database.NewAccount("0x01"), true), requests
+}
+
+func newTestSyncNode(t *testing.T, batchSize uint64) *Node {
+	dataDir, toshi, _, err := setupTestNodeDir(t, 1000000)
+	if err != nil {
+		t.Fatalf("error setting up test node directory. %s", err.Error())
+	}
+	t.Cleanup(func() { teardownTestNodeDir(dataDir) })
+
+	n := NewNode(dataDir, "127.0.0.1", 8086, toshi)
+	n.state, err = database.NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+
+	n.syncBatchSize = batchSize
+	n.newSyncedBlocks = make(chan database.Block, 10)
+	return n
+}
+
+func TestUpdateSyncState(t *testing.T) {
+	dataDir, toshi, _, err := setupTestNodeDir(t, 1000000)
+	defer teardownTestNodeDir(dataDir)
+	if err != nil {
+		t.Fatalf("error setting up test node directory. %s", err.Error())
+	}
+
+	n := NewNode(dataDir, "127.0.0.1", 8085, toshi)
+	n.state, err = database.NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load state. %s", err.Error())
+	}
+	defer n.state.Close()
+
+	peer := NewPeerNode("127.0.0.1", 8086, true, database.NewAccount("0x01"), true)
+	unreachable := []peerStatus{{peer: peer, err: fmt.Errorf("connection refused")}}
+
+	n.updateSyncState(unreachable)
+	if state := n.SyncState(); state != SyncStateDiscovering {
+		t.Fatalf("expected node which never heard from its peers to stay discovering, got '%s'", state)
+	}
+
+	ahead := StatusRes{Hash: database.Hash{0x01}, Number: 5}
+	n.updateSyncState([]peerStatus{{peer: peer, status: ahead}})
+	if state := n.SyncState(); state != SyncStateCatchingUp || n.BestPeerNumber() != 5 {
+		t.Fatalf("expected node behind its peer to be catching up to block 5, got '%s' to %d", n.SyncState(), n.BestPeerNumber())
+	}
+
+	n.updateSyncState(unreachable)
+	if state := n.SyncState(); state != SyncStateCatchingUp {
+		t.Fatalf("expected unreachable peers to leave the state as is, got '%s'", state)
+	}
+
+	n.updateSyncState([]peerStatus{{peer: peer}})
+	if state := n.SyncState(); state != SyncStateSynced {
+		t.Fatalf("expected node as tall as its peer to be synced, got '%s'", state)
+	}
+
+	solo := NewNode(dataDir, "127.0.0.1", 8087, toshi)
+	solo.state = n.state
+	solo.updateSyncState(nil)
+	if state := solo.SyncState(); state != SyncStateSynced {
+		t.Fatalf("expected node without any peers to be synced, got '%s'", state)
+	}
+}
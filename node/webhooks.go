@@ -0,0 +1,471 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/jTanG0506/go-blockchain/database"
+)
+
+const webhookTimeout = 10 * time.Second
+const webhookMaxAttempts = 6
+const webhookRetryBackoff = 2 * time.Second
+const webhookMaxRetryBackoff = time.Minute
+
+// webhookQueueSize is how many deliveries may wait to be sent before new ones
+// are dropped
+const webhookQueueSize = 1000
+
+const WebhookSignatureHeader = "X-TBS-Signature"
+const WebhookEventHeader = "X-TBS-Event"
+const WebhookDeliveryHeader = "X-TBS-Delivery"
+
+type WebhookEventType string
+
+const (
+	WebhookEventAddressActivity WebhookEventType = "address_activity"
+	WebhookEventTXConfirmed     WebhookEventType = "tx_confirmed"
+)
+
+// Webhook is a URL called when a watched account sends or receives funds, or
+// once a watched TX reached its confirmations
+type Webhook struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Secret        string           `json:"secret,omitempty"`
+	Accounts      []common.Address `json:"accounts,omitempty"`
+	TX            *database.Hash   `json:"tx,omitempty"`
+	Confirmations uint64           `json:"confirmations,omitempty"`
+	IncludedIn    *uint64          `json:"included_in,omitempty"`
+	Confirmed     bool             `json:"confirmed,omitempty"`
+}
+
+type AddWebhookReq struct {
+	URL           string   `json:"url"`
+	Secret        string   `json:"secret"`
+	Accounts      []string `json:"accounts"`
+	TX            string   `json:"tx"`
+	Confirmations uint64   `json:"confirmations"`
+}
+
+type WebhooksRes struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+type AddressActivityEvent struct {
+	Hash    database.Hash       `json:"block_hash"`
+	Number  uint64              `json:"block_number"`
+	Account common.Address      `json:"account"`
+	Balance uint                `json:"balance"`
+	Nonce   uint                `json:"nonce"`
+	Mined   bool                `json:"mined"`
+	TXs     []database.SignedTx `json:"txs"`
+}
+
+// WebhookPayload is the body POSTed to a webhook, signed with its secret in
+// the X-TBS-Signature header as sha256=<hex HMAC-SHA256 of the body>
+type WebhookPayload struct {
+	Delivery string           `json:"delivery_id"`
+	Webhook  string           `json:"webhook_id"`
+	Event    WebhookEventType `json:"event"`
+	Data     interface{}      `json:"data"`
+}
+
+type webhookDelivery struct {
+	url     string
+	secret  string
+	payload WebhookPayload
+}
+
+// webhookRegistry holds the webhooks registered on the node, persisted in the
+// data dir along with the progress of the TXs watched
+type webhookRegistry struct {
+	mu    sync.Mutex
+	path  string
+	hooks []Webhook
+}
+
+func loadWebhookRegistry(dataDir string) (*webhookRegistry, error) {
+	r := &webhookRegistry{path: getWebhooksFilePath(dataDir), hooks: make([]Webhook, 0)}
+
+	content, err := ioutil.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(content, &r.hooks)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode '%s'. %s", r.path, err.Error())
+	}
+
+	return r, nil
+}
+
+func (r *webhookRegistry) add(req AddWebhookReq) (Webhook, error) {
+	hookURL, err := url.Parse(req.URL)
+	if err != nil || (hookURL.Scheme != "http" && hookURL.Scheme != "https") || hookURL.Host == "" {
+		return Webhook{}, fmt.Errorf("'%s' is not a valid webhook URL, expected http(s)://host/path", req.URL)
+	}
+
+	hook := Webhook{URL: req.URL, Secret: req.Secret}
+	for _, raw := range req.Accounts {
+		if !common.IsHexAddress(raw) {
+			return Webhook{}, fmt.Errorf("'%s' is not a valid account", raw)
+		}
+
+		hook.Accounts = append(hook.Accounts, database.NewAccount(raw))
+	}
+
+	if req.TX != "" {
+		txHash, err := parseTXHash(req.TX)
+		if err != nil {
+			return Webhook{}, err
+		}
+
+		hook.TX = &txHash
+		hook.Confirmations = req.Confirmations
+		if hook.Confirmations == 0 {
+			hook.Confirmations = 1
+		}
+	} else if req.Confirmations > 0 {
+		return Webhook{}, fmt.Errorf("confirmations are only counted for a watched TX")
+	}
+
+	if len(hook.Accounts) == 0 && hook.TX == nil {
+		return Webhook{}, fmt.Errorf("nothing to watch, set accounts or a TX")
+	}
+
+	hook.ID, err = randomHex(8)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	if hook.Secret == "" {
+		hook.Secret, err = randomHex(32)
+		if err != nil {
+			return Webhook{}, err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.hooks = append(r.hooks, hook)
+	err = r.save()
+	if err != nil {
+		r.hooks = r.hooks[:len(r.hooks)-1]
+		return Webhook{}, err
+	}
+
+	return hook, nil
+}
+
+func (r *webhookRegistry) remove(id string) (Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, hook := range r.hooks {
+		if hook.ID != id {
+			continue
+		}
+
+		hooks := append(append(make([]Webhook, 0, len(r.hooks)-1), r.hooks[:i]...), r.hooks[i+1:]...)
+		previous := r.hooks
+		r.hooks = hooks
+
+		err := r.save()
+		if err != nil {
+			r.hooks = previous
+			return Webhook{}, err
+		}
+
+		hook.Secret = ""
+		return hook, nil
+	}
+
+	return Webhook{}, fmt.Errorf("webhook '%s' doesn't exist", id)
+}
+
+// list returns the webhooks without their secret, which is only returned
+// when registering
+func (r *webhookRegistry) list() []Webhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hooks := make([]Webhook, len(r.hooks))
+	for i, hook := range r.hooks {
+		hook.Secret = ""
+		hooks[i] = hook
+	}
+
+	return hooks
+}
+
+// blockAdded returns the deliveries the block triggers, recording which
+// block included the TXs watched to count their confirmations
+func (r *webhookRegistry) blockAdded(b addedBlock) ([]webhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	number := b.block.Header.Number
+	txHashes := make(map[database.Hash]bool)
+	for _, tx := range b.block.TXs {
+		txHash, err := tx.Hash()
+		if err == nil {
+			txHashes[txHash] = true
+		}
+	}
+
+	deliveries := make([]webhookDelivery, 0)
+	changed := false
+	for i := range r.hooks {
+		hook := &r.hooks[i]
+
+		for _, account := range hook.Accounts {
+			state, touched := b.diff.Accounts[account]
+			if !touched {
+				continue
+			}
+
+			event := AddressActivityEvent{b.hash, number, account, state.Balance, state.Nonce, b.block.Header.Miner == account, make([]database.SignedTx, 0)}
+			for _, tx := range b.block.TXs {
+				if tx.From == account || tx.To == account {
+					event.TXs = append(event.TXs, tx)
+				}
+			}
+
+			deliveries = append(deliveries, newWebhookDelivery(*hook, WebhookEventAddressActivity, event))
+		}
+
+		if hook.TX == nil || hook.Confirmed {
+			continue
+		}
+
+		if hook.IncludedIn == nil && txHashes[*hook.TX] {
+			includedIn := number
+			hook.IncludedIn = &includedIn
+			changed = true
+		}
+
+		if hook.IncludedIn != nil && number+1-*hook.IncludedIn >= hook.Confirmations {
+			hook.Confirmed = true
+			changed = true
+
+			event := TXConfirmationEvent{*hook.TX, b.hash, number, number + 1 - *hook.IncludedIn}
+			deliveries = append(deliveries, newWebhookDelivery(*hook, WebhookEventTXConfirmed, event))
+		}
+	}
+
+	if !changed {
+		return deliveries, nil
+	}
+
+	return deliveries, r.save()
+}
+
+func (r *webhookRegistry) save() error {
+	hooksJson, err := json.MarshalIndent(r.hooks, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(r.path+".tmp", hooksJson, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(r.path+".tmp", r.path)
+}
+
+func newWebhookDelivery(hook Webhook, event WebhookEventType, data interface{}) webhookDelivery {
+	id, _ := randomHex(16)
+	return webhookDelivery{hook.URL, hook.Secret, WebhookPayload{id, hook.ID, event, data}}
+}
+
+func (n *Node) notifyWebhooks(b addedBlock) {
+	if n.webhooks == nil {
+		return
+	}
+
+	deliveries, err := n.webhooks.blockAdded(b)
+	if err != nil {
+		n.webhookLog.Error("Unable to save webhooks", "err", err)
+	}
+
+	for _, d := range deliveries {
+		select {
+		case n.webhookQueue <- d:
+		default:
+			n.webhookLog.Error("Dropping webhook delivery, the queue is full", "webhook", d.payload.Webhook, "event", d.payload.Event)
+		}
+	}
+}
+
+// deliverWebhooks sends the queued deliveries until the context is cancelled,
+// each one retried on its own so a failing receiver doesn't hold others back
+func (n *Node) deliverWebhooks(ctx context.Context) {
+	client := &http.Client{Timeout: webhookTimeout}
+	var deliveries sync.WaitGroup
+
+	for {
+		select {
+		case d := <-n.webhookQueue:
+			deliveries.Add(1)
+			go func() {
+				defer deliveries.Done()
+
+				err := deliverWebhook(ctx, client, d, webhookRetryBackoff, n.webhookLog)
+				if err != nil && ctx.Err() == nil {
+					n.webhookLog.Error("Failed to deliver webhook", "webhook", d.payload.Webhook, "delivery", d.payload.Delivery, "err", err)
+				}
+			}()
+		case <-ctx.Done():
+			deliveries.Wait()
+			return
+		}
+	}
+}
+
+// deliverWebhook POSTs the payload until the receiver responds with a 2xx
+// status, backing off exponentially between attempts
+func deliverWebhook(ctx context.Context, client *http.Client, d webhookDelivery, backoff time.Duration, logger log.Logger) error {
+	body, err := json.Marshal(d.payload)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = postWebhook(ctx, client, d, body)
+		if err == nil {
+			logger.Debug("Delivered webhook", "webhook", d.payload.Webhook, "delivery", d.payload.Delivery, "attempt", attempt)
+			return nil
+		}
+
+		if attempt == webhookMaxAttempts {
+			return fmt.Errorf("giving up after %d attempts. %s", attempt, err.Error())
+		}
+
+		logger.Debug("Retrying webhook delivery", "webhook", d.payload.Webhook, "delivery", d.payload.Delivery, "attempt", attempt, "in", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		backoff *= 2
+		if backoff > webhookMaxRetryBackoff {
+			backoff = webhookMaxRetryBackoff
+		}
+	}
+}
+
+func postWebhook(ctx context.Context, client *http.Client, d webhookDelivery, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, string(d.payload.Event))
+	req.Header.Set(WebhookDeliveryHeader, d.payload.Delivery)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(d.secret, body))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("receiver responded with status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// SignWebhookPayload returns the X-TBS-Signature header of a webhook body,
+// receivers compute it with the webhook's secret to check the body
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// webhooksHandler lists the webhooks on GET and registers one on POST
+func webhooksHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	switch r.Method {
+	case http.MethodGet:
+		writeRes(w, WebhooksRes{node.webhooks.list()})
+	case http.MethodPost:
+		req := AddWebhookReq{}
+		err := readRequest(r, &req)
+		if err != nil {
+			writeErrRes(w, err)
+			return
+		}
+
+		hook, err := node.webhooks.add(req)
+		if err != nil {
+			writeErrRes(w, err)
+			return
+		}
+
+		node.webhookLog.Info("Registered webhook", "webhook", hook.ID, "url", hook.URL)
+		writeRes(w, hook)
+	default:
+		writeResWithStatus(w, http.StatusMethodNotAllowed, ErrorRes{fmt.Sprintf("method %s isn't allowed, expected GET or POST", r.Method)})
+	}
+}
+
+// webhookHandler removes the webhook of /webhooks/{id} on DELETE
+func webhookHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if r.Method != http.MethodDelete {
+		writeResWithStatus(w, http.StatusMethodNotAllowed, ErrorRes{fmt.Sprintf("method %s isn't allowed, expected DELETE", r.Method)})
+		return
+	}
+
+	hook, err := node.webhooks.remove(strings.TrimPrefix(r.URL.Path, webhookEndpoint))
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	node.webhookLog.Info("Removed webhook", "webhook", hook.ID, "url", hook.URL)
+	writeRes(w, hook)
+}
+
+func getWebhooksFilePath(dataDir string) string {
+	return filepath.Join(dataDir, "webhooks.json")
+}
@@ -0,0 +1,152 @@
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/jTanG0506/go-blockchain/database"
+)
+
+func TestWebhookRegistry(t *testing.T) {
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	registry, err := loadWebhookRegistry(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load webhooks. %s", err.Error())
+	}
+
+	_, err = registry.add(AddWebhookReq{URL: "ftp://example.com", Accounts: []string{database.NewAccount("0x01").Hex()}})
+	if err == nil {
+		t.Fatalf("expected a non HTTP webhook URL to be rejected")
+	}
+
+	_, err = registry.add(AddWebhookReq{URL: "http://example.com"})
+	if err == nil {
+		t.Fatalf("expected a webhook watching nothing to be rejected")
+	}
+
+	tx := database.SignedTx{Tx: database.NewTx(database.NewAccount("0x01"), database.NewAccount("0x02"), 10, 1, "")}
+	txHash, err := tx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accountHook, err := registry.add(AddWebhookReq{URL: "http://example.com/accounts", Accounts: []string{database.NewAccount("0x02").Hex()}})
+	if err != nil {
+		t.Fatalf("unable to add account webhook. %s", err.Error())
+	}
+
+	txHook, err := registry.add(AddWebhookReq{URL: "http://example.com/tx", TX: txHash.Hex(), Confirmations: 2})
+	if err != nil {
+		t.Fatalf("unable to add TX webhook. %s", err.Error())
+	}
+
+	if accountHook.Secret == "" {
+		t.Fatalf("expected a secret to be generated")
+	}
+
+	miner := database.NewAccount("0x03")
+	blocks := []database.Block{
+		database.NewBlock(database.Hash{}, 1, 0, 0, miner, []database.SignedTx{tx}),
+		database.NewBlock(database.Hash{}, 2, 0, 0, miner, []database.SignedTx{}),
+	}
+
+	deliveries, err := registry.blockAdded(newTestAddedBlock(blocks[0], database.NewAccount("0x02")))
+	if err != nil {
+		t.Fatalf("unable to process block 1. %s", err.Error())
+	}
+
+	if len(deliveries) != 1 || deliveries[0].payload.Event != WebhookEventAddressActivity || deliveries[0].url != accountHook.URL {
+		t.Fatalf("expected the account webhook to fire for block 1, got %+v", deliveries)
+	}
+
+	// Reloaded to check the block including the TX was persisted
+	registry, err = loadWebhookRegistry(dataDir)
+	if err != nil {
+		t.Fatalf("unable to reload webhooks. %s", err.Error())
+	}
+
+	deliveries, err = registry.blockAdded(newTestAddedBlock(blocks[1]))
+	if err != nil {
+		t.Fatalf("unable to process block 2. %s", err.Error())
+	}
+
+	if len(deliveries) != 1 || deliveries[0].payload.Event != WebhookEventTXConfirmed || deliveries[0].secret != txHook.Secret {
+		t.Fatalf("expected the TX webhook to fire with 2 confirmations at block 2, got %+v", deliveries)
+	}
+
+	if confirmation := deliveries[0].payload.Data.(TXConfirmationEvent); confirmation.Confirmations != 2 {
+		t.Fatalf("expected 2 confirmations, got %d", confirmation.Confirmations)
+	}
+
+	_, err = registry.remove(accountHook.ID)
+	if err != nil {
+		t.Fatalf("unable to remove webhook. %s", err.Error())
+	}
+
+	hooks := registry.list()
+	if len(hooks) != 1 || hooks[0].ID != txHook.ID || !hooks[0].Confirmed || hooks[0].Secret != "" {
+		t.Fatalf("expected only the confirmed TX webhook without its secret, got %+v", hooks)
+	}
+}
+
+func TestDeliverWebhookRetries(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	signatures := make([]bool, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		signatures = append(signatures, r.Header.Get(WebhookSignatureHeader) == SignWebhookPayload("secret", body))
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	d := webhookDelivery{server.URL, "secret", WebhookPayload{"delivery", "webhook", WebhookEventAddressActivity, AddressActivityEvent{}}}
+	err := deliverWebhook(context.Background(), server.Client(), d, time.Millisecond, log.Root())
+	if err != nil {
+		t.Fatalf("expected delivery to succeed on the third attempt. %s", err.Error())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+
+	for i, valid := range signatures {
+		if !valid {
+			t.Fatalf("expected attempt %d to be signed with the webhook's secret", i+1)
+		}
+	}
+}
+
+func newTestAddedBlock(block database.Block, accounts ...common.Address) addedBlock {
+	hash, _ := block.Hash()
+	diff := database.StateDiff{Number: block.Header.Number, Hash: hash, Accounts: make(map[common.Address]database.AccountState)}
+	for _, account := range accounts {
+		diff.Accounts[account] = database.AccountState{Number: block.Header.Number, Hash: hash}
+	}
+
+	return addedBlock{hash, block, diff}
+}
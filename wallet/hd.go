@@ -0,0 +1,141 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pborman/uuid"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// DefaultHDBasePath is the BIP-44 path accounts are derived under, the
+// account index is appended to it. TBS addresses are Ethereum addresses, so
+// the Ethereum coin type is used to stay compatible with existing HD wallets.
+const DefaultHDBasePath = "m/44'/60'/0'/0"
+
+const mnemonicEntropyBits = 256
+const bip32MasterKeySalt = "Bitcoin seed"
+const bip32HardenedOffset = 0x80000000
+
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(mnemonicEntropyBits)
+	if err != nil {
+		return "", err
+	}
+
+	return bip39.NewMnemonic(entropy)
+}
+
+// DeriveAccountKey derives the key of the account with the given index under
+// the BIP-44 base path from a BIP-39 mnemonic and its optional passphrase.
+func DeriveAccountKey(mnemonic, passphrase, basePath string, index uint32) (*keystore.Key, error) {
+	path, err := accounts.ParseDerivationPath(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return DeriveKey(mnemonic, passphrase, append(path, index))
+}
+
+func DeriveKey(mnemonic, passphrase string, path accounts.DerivationPath) (*keystore.Key, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mnemonic. %s", err.Error())
+	}
+
+	privKey, chainCode := bip32MasterKey(seed)
+	for _, index := range path {
+		privKey, chainCode, err = bip32ChildKey(privKey, chainCode, index)
+		if err != nil {
+			return nil, fmt.Errorf("unable to derive key at path %s. %s", path.String(), err.Error())
+		}
+	}
+
+	privateKeyECDSA, err := crypto.ToECDSA(privKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &keystore.Key{
+		Id:         uuid.NewRandom(),
+		Address:    crypto.PubkeyToAddress(privateKeyECDSA.PublicKey),
+		PrivateKey: privateKeyECDSA,
+	}
+
+	return key, nil
+}
+
+// ErrAccountAlreadyExists is returned along with the account's address when
+// importing a key which is already in the keystore. The stored key is left
+// as is, so it's still encrypted with its previous password.
+var ErrAccountAlreadyExists = keystore.ErrAccountAlreadyExists
+
+// ImportKey encrypts a key with the password and stores it in the data dir's
+// keystore
+func ImportKey(dataDir string, key *ecdsa.PrivateKey, password string) (common.Address, error) {
+	ks := openKeystore(GetKeystoreDirPath(dataDir))
+
+	acc, err := ks.ImportECDSA(key, password)
+	if err == keystore.ErrAccountAlreadyExists {
+		return acc.Address, ErrAccountAlreadyExists
+	}
+
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	return acc.Address, nil
+}
+
+func bip32MasterKey(seed []byte) (privKey, chainCode []byte) {
+	mac := hmac.New(sha512.New, []byte(bip32MasterKeySalt))
+	mac.Write(seed)
+	i := mac.Sum(nil)
+
+	return i[:32], i[32:]
+}
+
+func bip32ChildKey(parentKey, parentChainCode []byte, index uint32) (privKey, chainCode []byte, err error) {
+	data := make([]byte, 0, 37)
+	if index >= bip32HardenedOffset {
+		data = append(data, 0x00)
+		data = append(data, parentKey...)
+	} else {
+		parent, err := crypto.ToECDSA(parentKey)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		data = append(data, crypto.CompressPubkey(&parent.PublicKey)...)
+	}
+
+	indexBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(indexBytes, index)
+	data = append(data, indexBytes...)
+
+	mac := hmac.New(sha512.New, parentChainCode)
+	mac.Write(data)
+	i := mac.Sum(nil)
+
+	curveOrder := crypto.S256().Params().N
+	il := new(big.Int).SetBytes(i[:32])
+	if il.Cmp(curveOrder) >= 0 {
+		return nil, nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+
+	child := il.Add(il, new(big.Int).SetBytes(parentKey))
+	child.Mod(child, curveOrder)
+	if child.Sign() == 0 {
+		return nil, nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+
+	return child.FillBytes(make([]byte, 32)), i[32:], nil
+}
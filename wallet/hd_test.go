@@ -0,0 +1,73 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/jTanG0506/go-blockchain/database"
+	"github.com/jTanG0506/go-blockchain/fs"
+)
+
+// BIP-39 test mnemonic with well known derived Ethereum addresses
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestDeriveAccountKey(t *testing.T) {
+	expected := []string{
+		"0x9858EfFD232B4033E47d90003D41EC34EcaEda94",
+		"0x6Fac4D18c912343BF86fa7049364Dd4E424Ab9C0",
+	}
+
+	for i, address := range expected {
+		key, err := DeriveAccountKey(testMnemonic, "", DefaultHDBasePath, uint32(i))
+		if err != nil {
+			t.Fatalf("unable to derive account %d. %s", i, err.Error())
+		}
+
+		if key.Address.Hex() != address {
+			t.Fatalf("account %d was derived as %s, expected %s", i, key.Address.Hex(), address)
+		}
+	}
+}
+
+func TestNewMnemonicRestoresSameAccounts(t *testing.T) {
+	mnemonic, err := NewMnemonic()
+	if err != nil {
+		t.Fatalf("unable to create mnemonic. %s", err.Error())
+	}
+
+	tmpDir, err := ioutil.TempDir("", "wallet_test")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory. %s", err.Error())
+	}
+	defer fs.RemoveDir(tmpDir)
+
+	key, err := DeriveAccountKey(mnemonic, "", DefaultHDBasePath, 0)
+	if err != nil {
+		t.Fatalf("unable to derive account. %s", err.Error())
+	}
+
+	imported, err := ImportKey(tmpDir, key.PrivateKey, testKsPassword)
+	if err != nil {
+		t.Fatalf("unable to import derived key. %s", err.Error())
+	}
+
+	restoredKey, err := DeriveAccountKey(mnemonic, "", DefaultHDBasePath, 0)
+	if err != nil {
+		t.Fatalf("unable to derive account. %s", err.Error())
+	}
+
+	restored, err := ImportKey(tmpDir, restoredKey.PrivateKey, "new password")
+	if err != ErrAccountAlreadyExists {
+		t.Fatalf("expected importing the restored key again to report the account already exists, got %v", err)
+	}
+
+	if imported != restored {
+		t.Fatalf("mnemonic restored account %s, expected %s", restored.Hex(), imported.Hex())
+	}
+
+	// The account keeps the password it was first imported with
+	_, err = SignTxWithKeystoreAccount(database.NewTx(imported, imported, 1, 1, ""), imported, testKsPassword, GetKeystoreDirPath(tmpDir))
+	if err != nil {
+		t.Fatalf("expected the account to keep its first password. %s", err.Error())
+	}
+}
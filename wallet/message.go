@@ -0,0 +1,32 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// signedMessagePrefix separates signed messages from signed TXs. TXs are
+// signed over their JSON or RLP encoding, neither of which can start with the
+// 0x19 byte, so a message signature can never be replayed as a TX.
+const signedMessagePrefix = "\x19TBS Signed Message:\n"
+
+func SignMessage(msg []byte, privKey *ecdsa.PrivateKey) ([]byte, error) {
+	return Sign(prefixMessage(msg), privKey)
+}
+
+// VerifyMessage returns the account which signed the message
+func VerifyMessage(msg, sig []byte) (common.Address, error) {
+	publicKey, err := Verify(prefixMessage(msg), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
+
+func prefixMessage(msg []byte) []byte {
+	return append([]byte(fmt.Sprintf("%s%d", signedMessagePrefix, len(msg))), msg...)
+}
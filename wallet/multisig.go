@@ -0,0 +1,98 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jTanG0506/go-blockchain/database"
+)
+
+// MultisigProposal is a TX from a multisig account passed around the owners,
+// each adding their signature offline, until enough of them have signed it to
+// be combined into a SignedTx.
+type MultisigProposal struct {
+	Tx       database.Tx       `json:"tx"`
+	Multisig database.Multisig `json:"multisig"`
+	Sigs     [][]byte          `json:"signatures"`
+}
+
+func NewMultisigProposal(tx database.Tx, multisig database.Multisig) (MultisigProposal, error) {
+	if tx.From != multisig.Address() {
+		return MultisigProposal{}, fmt.Errorf("TX sender '%s' isn't the multisig account '%s'", tx.From.String(), multisig.Address().String())
+	}
+
+	return MultisigProposal{tx, multisig, make([][]byte, 0)}, nil
+}
+
+func LoadMultisigProposal(path string) (MultisigProposal, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return MultisigProposal{}, err
+	}
+
+	var proposal MultisigProposal
+	err = json.Unmarshal(content, &proposal)
+	if err != nil {
+		return MultisigProposal{}, err
+	}
+
+	return proposal, nil
+}
+
+func (p MultisigProposal) Save(path string) error {
+	content, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, content, 0644)
+}
+
+// Sign adds the owner's partial signature to the proposal, replacing the one
+// they already added if they sign it again
+func (p *MultisigProposal) Sign(privKey *ecdsa.PrivateKey) error {
+	signer := crypto.PubkeyToAddress(privKey.PublicKey)
+	if !p.Multisig.IsOwner(signer) {
+		return fmt.Errorf("'%s' isn't an owner of multisig account '%s'", signer.String(), p.Tx.From.String())
+	}
+
+	signedTx, err := SignTx(p.Tx, privKey)
+	if err != nil {
+		return err
+	}
+
+	txHash, err := p.Tx.Hash()
+	if err != nil {
+		return err
+	}
+
+	for i, sig := range p.Sigs {
+		pubKey, err := crypto.SigToPub(txHash[:], sig)
+		if err == nil && crypto.PubkeyToAddress(*pubKey) == signer {
+			p.Sigs[i] = signedTx.Sig
+			return nil
+		}
+	}
+
+	p.Sigs = append(p.Sigs, signedTx.Sig)
+	return nil
+}
+
+// Combine turns the proposal into a SignedTx once enough owners signed it
+func (p MultisigProposal) Combine() (database.SignedTx, error) {
+	signedTx := database.NewMultisigSignedTx(p.Tx, p.Multisig, p.Sigs)
+
+	ok, err := signedTx.IsSigAuthentic()
+	if err != nil {
+		return database.SignedTx{}, err
+	}
+
+	if !ok {
+		return database.SignedTx{}, fmt.Errorf("multisig TX needs %d distinct owner signatures, has %d signatures", p.Multisig.Threshold, len(p.Sigs))
+	}
+
+	return signedTx, nil
+}
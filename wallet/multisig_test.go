@@ -0,0 +1,102 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jTanG0506/go-blockchain/database"
+)
+
+func TestMultisigProposal(t *testing.T) {
+	keys := make(map[common.Address]*keystore.Key)
+	owners := make([]common.Address, 0)
+	for i := 0; i < 3; i++ {
+		key, err := NewRandomKey()
+		if err != nil {
+			t.Fatalf("unable to create random key. %s", err.Error())
+		}
+
+		keys[key.Address] = key
+		owners = append(owners, key.Address)
+	}
+
+	multisig, err := database.NewMultisig(2, owners)
+	if err != nil {
+		t.Fatalf("unable to create multisig. %s", err.Error())
+	}
+
+	reordered, err := database.NewMultisig(2, []common.Address{owners[2], owners[0], owners[1]})
+	if err != nil {
+		t.Fatalf("unable to create multisig. %s", err.Error())
+	}
+
+	if multisig.Address() != reordered.Address() {
+		t.Fatalf("multisig address must not depend on the order of its owners")
+	}
+
+	tx := database.NewTx(multisig.Address(), owners[0], 100, 1, "")
+	proposal, err := NewMultisigProposal(tx, multisig)
+	if err != nil {
+		t.Fatalf("unable to create multisig proposal. %s", err.Error())
+	}
+
+	err = proposal.Sign(keys[owners[0]].PrivateKey)
+	if err != nil {
+		t.Fatalf("unable to sign proposal. %s", err.Error())
+	}
+
+	_, err = proposal.Combine()
+	if err == nil {
+		t.Fatalf("expected a proposal with 1 of 2 signatures not to combine")
+	}
+
+	err = proposal.Sign(keys[owners[0]].PrivateKey)
+	if err != nil {
+		t.Fatalf("unable to sign proposal again. %s", err.Error())
+	}
+
+	if len(proposal.Sigs) != 1 {
+		t.Fatalf("expected signing twice to keep a single signature of the owner, got %d", len(proposal.Sigs))
+	}
+
+	duplicate := proposal
+	duplicate.Sigs = append([][]byte{}, proposal.Sigs...)
+	duplicate.Sigs = append(duplicate.Sigs, proposal.Sigs[0])
+	_, err = duplicate.Combine()
+	if err == nil {
+		t.Fatalf("expected the same owner signing twice not to reach the threshold")
+	}
+
+	outsider, err := NewRandomKey()
+	if err != nil {
+		t.Fatalf("unable to create random key. %s", err.Error())
+	}
+
+	err = proposal.Sign(outsider.PrivateKey)
+	if err == nil {
+		t.Fatalf("expected a non owner not to be able to sign the proposal")
+	}
+
+	err = proposal.Sign(keys[owners[1]].PrivateKey)
+	if err != nil {
+		t.Fatalf("unable to sign proposal. %s", err.Error())
+	}
+
+	signedTx, err := proposal.Combine()
+	if err != nil {
+		t.Fatalf("unable to combine proposal with 2 of 2 signatures. %s", err.Error())
+	}
+
+	ok, err := signedTx.IsSigAuthentic()
+	if err != nil || !ok {
+		t.Fatalf("combined multisig TX should be authentic. %v", err)
+	}
+
+	forged := signedTx
+	forged.Value = 1000
+	ok, _ = forged.IsSigAuthentic()
+	if ok {
+		t.Fatalf("multisig TX with a modified value should not be authentic")
+	}
+}
@@ -0,0 +1,69 @@
+package wallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/jTanG0506/go-blockchain/database"
+)
+
+// TX files move TXs between an online machine, which knows the sender's
+// nonce and can reach a node, and an offline machine holding the keys. The
+// format is versioned so files written today can still be read later.
+const TxFileVersion = 1
+
+const (
+	TxFileTypeUnsigned = "unsigned-tx"
+	TxFileTypeSigned   = "signed-tx"
+)
+
+type TxFile struct {
+	Version  int                `json:"version"`
+	Type     string             `json:"type"`
+	Tx       *database.Tx       `json:"tx,omitempty"`
+	SignedTx *database.SignedTx `json:"signed_tx,omitempty"`
+}
+
+func NewUnsignedTxFile(tx database.Tx) TxFile {
+	return TxFile{Version: TxFileVersion, Type: TxFileTypeUnsigned, Tx: &tx}
+}
+
+func NewSignedTxFile(tx database.SignedTx) TxFile {
+	return TxFile{Version: TxFileVersion, Type: TxFileTypeSigned, SignedTx: &tx}
+}
+
+func LoadTxFile(path string) (TxFile, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return TxFile{}, err
+	}
+
+	var txFile TxFile
+	err = json.Unmarshal(content, &txFile)
+	if err != nil {
+		return TxFile{}, fmt.Errorf("unable to read TX file '%s'. %s", path, err.Error())
+	}
+
+	if txFile.Version != TxFileVersion {
+		return TxFile{}, fmt.Errorf("unsupported TX file version %d, expected %d", txFile.Version, TxFileVersion)
+	}
+
+	switch {
+	case txFile.Type == TxFileTypeUnsigned && txFile.Tx != nil:
+	case txFile.Type == TxFileTypeSigned && txFile.SignedTx != nil:
+	default:
+		return TxFile{}, fmt.Errorf("TX file '%s' has no TX of type '%s'", path, txFile.Type)
+	}
+
+	return txFile, nil
+}
+
+func (f TxFile) Save(path string) error {
+	content, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, content, 0644)
+}
@@ -0,0 +1,68 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/jTanG0506/go-blockchain/database"
+	"github.com/jTanG0506/go-blockchain/fs"
+)
+
+func TestTxFileRoundTrip(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "wallet_test")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory. %s", err.Error())
+	}
+	defer fs.RemoveDir(tmpDir)
+
+	key, err := NewRandomKey()
+	if err != nil {
+		t.Fatalf("unable to create random key. %s", err.Error())
+	}
+
+	tx := database.NewTx(key.Address, database.NewAccount(database.DevToshiAccount), 100, 1, "offline")
+	unsignedPath := filepath.Join(tmpDir, "unsigned.json")
+	err = NewUnsignedTxFile(tx).Save(unsignedPath)
+	if err != nil {
+		t.Fatalf("unable to save unsigned TX file. %s", err.Error())
+	}
+
+	unsigned, err := LoadTxFile(unsignedPath)
+	if err != nil {
+		t.Fatalf("unable to load unsigned TX file. %s", err.Error())
+	}
+
+	signedTx, err := SignTx(*unsigned.Tx, key.PrivateKey)
+	if err != nil {
+		t.Fatalf("unable to sign TX. %s", err.Error())
+	}
+
+	signedPath := filepath.Join(tmpDir, "signed.json")
+	err = NewSignedTxFile(signedTx).Save(signedPath)
+	if err != nil {
+		t.Fatalf("unable to save signed TX file. %s", err.Error())
+	}
+
+	signed, err := LoadTxFile(signedPath)
+	if err != nil {
+		t.Fatalf("unable to load signed TX file. %s", err.Error())
+	}
+
+	ok, err := signed.SignedTx.IsSigAuthentic()
+	if err != nil || !ok {
+		t.Fatalf("TX signed from a loaded file should be authentic. %v", err)
+	}
+
+	future := NewSignedTxFile(signedTx)
+	future.Version = TxFileVersion + 1
+	err = future.Save(signedPath)
+	if err != nil {
+		t.Fatalf("unable to save signed TX file. %s", err.Error())
+	}
+
+	_, err = LoadTxFile(signedPath)
+	if err == nil {
+		t.Fatalf("expected a TX file with an unknown version to be rejected")
+	}
+}
@@ -18,20 +18,12 @@ import (
 
 const keystoreDirName = "keystore"
 
-const ToshiAccount = "0xe5ED8C1829192380205b1E7BB5A3F44baf181d25"
-const JTangAccount = "0xf70D226203FDDa745C3B160D92Ee665A71191D6a"
-const QudsiiAccount = "0x7573428c0394133cC5A3FC5533b9B04241D1271E"
-
 func GetKeystoreDirPath(dataDir string) string {
 	return filepath.Join(dataDir, keystoreDirName)
 }
 
 func NewKeystoreAccount(dataDir string, password string) (common.Address, error) {
-	ks := keystore.NewKeyStore(
-		GetKeystoreDirPath(dataDir),
-		keystore.StandardScryptN,
-		keystore.StandardScryptP,
-	)
+	ks := openKeystore(GetKeystoreDirPath(dataDir))
 
 	acc, err := ks.NewAccount(password)
 	if err != nil {
@@ -41,19 +33,56 @@ func NewKeystoreAccount(dataDir string, password string) (common.Address, error)
 	return acc.Address, nil
 }
 
-func SignTxWithKeystoreAccount(tx database.Tx, acc common.Address, pwd, keystoreDir string) (database.SignedTx, error) {
-	ks := keystore.NewKeyStore(keystoreDir, keystore.StandardScryptN, keystore.StandardScryptP)
+// ListKeystoreAccounts returns every account in the data dir's keystore,
+// sorted by the name of its keystore file
+func ListKeystoreAccounts(dataDir string) []accounts.Account {
+	return openKeystore(GetKeystoreDirPath(dataDir)).Accounts()
+}
+
+// ImportPrivateKeyFile imports a hex encoded private key from a file into the
+// data dir's keystore, encrypted with the password
+func ImportPrivateKeyFile(dataDir, path, password string) (common.Address, error) {
+	privKey, err := crypto.LoadECDSA(path)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("unable to load private key from '%s'. %s", path, err.Error())
+	}
+
+	return ImportKey(dataDir, privKey, password)
+}
+
+// ExportKeystoreAccount decrypts an account from the data dir's keystore and
+// returns its keystore JSON re-encrypted with a new password
+func ExportKeystoreAccount(dataDir string, acc common.Address, pwd, newPwd string) ([]byte, error) {
+	ks := openKeystore(GetKeystoreDirPath(dataDir))
 	ksAccount, err := ks.Find(accounts.Account{Address: acc})
 	if err != nil {
-		return database.SignedTx{}, err
+		return nil, err
 	}
 
-	ksAccountJson, err := ioutil.ReadFile(ksAccount.URL.Path)
+	return ks.Export(ksAccount, pwd, newPwd)
+}
+
+func ChangeKeystorePassword(dataDir string, acc common.Address, pwd, newPwd string) error {
+	ks := openKeystore(GetKeystoreDirPath(dataDir))
+	ksAccount, err := ks.Find(accounts.Account{Address: acc})
 	if err != nil {
-		return database.SignedTx{}, err
+		return err
 	}
 
-	key, err := keystore.DecryptKey(ksAccountJson, pwd)
+	return ks.Update(ksAccount, pwd, newPwd)
+}
+
+func DecryptKeystoreFile(path, pwd string) (*keystore.Key, error) {
+	keyJson, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return keystore.DecryptKey(keyJson, pwd)
+}
+
+func SignTxWithKeystoreAccount(tx database.Tx, acc common.Address, pwd, keystoreDir string) (database.SignedTx, error) {
+	key, err := decryptKeystoreAccount(acc, pwd, keystoreDir)
 	if err != nil {
 		return database.SignedTx{}, err
 	}
@@ -66,6 +95,20 @@ func SignTxWithKeystoreAccount(tx database.Tx, acc common.Address, pwd, keystore
 	return signedTx, nil
 }
 
+func decryptKeystoreAccount(acc common.Address, pwd, keystoreDir string) (*keystore.Key, error) {
+	ks := openKeystore(keystoreDir)
+	ksAccount, err := ks.Find(accounts.Account{Address: acc})
+	if err != nil {
+		return nil, err
+	}
+
+	return DecryptKeystoreFile(ksAccount.URL.Path, pwd)
+}
+
+func openKeystore(keystoreDir string) *keystore.KeyStore {
+	return keystore.NewKeyStore(keystoreDir, keystore.StandardScryptN, keystore.StandardScryptP)
+}
+
 func SignTx(tx database.Tx, privateKey *ecdsa.PrivateKey) (database.SignedTx, error) {
 	rawTx, err := tx.Encode()
 	if err != nil {
@@ -5,8 +5,10 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"io/ioutil"
+	"path/filepath"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/jTanG0506/go-blockchain/database"
@@ -122,3 +124,97 @@ func TestSignedForgedTxWithKeystoreAccount(t *testing.T) {
 		t.Fatalf("signature on transaction should not be authentic. %s", err.Error())
 	}
 }
+
+func TestImportExportAndChangePassword(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "wallet_test")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory. %s", err.Error())
+	}
+	defer fs.RemoveDir(tmpDir)
+
+	key, err := NewRandomKey()
+	if err != nil {
+		t.Fatalf("unable to create random key. %s", err.Error())
+	}
+
+	pkFile := filepath.Join(tmpDir, "private.key")
+	err = crypto.SaveECDSA(pkFile, key.PrivateKey)
+	if err != nil {
+		t.Fatalf("unable to write private key file. %s", err.Error())
+	}
+
+	acc, err := ImportPrivateKeyFile(tmpDir, pkFile, testKsPassword)
+	if err != nil {
+		t.Fatalf("unable to import private key file. %s", err.Error())
+	}
+
+	if acc != key.Address {
+		t.Fatalf("imported account %s, expected %s", acc.Hex(), key.Address.Hex())
+	}
+
+	accounts := ListKeystoreAccounts(tmpDir)
+	if len(accounts) != 1 || accounts[0].Address != acc {
+		t.Fatalf("expected keystore to only list account %s, got %v", acc.Hex(), accounts)
+	}
+
+	newPassword := "new" + testKsPassword
+	err = ChangeKeystorePassword(tmpDir, acc, testKsPassword, newPassword)
+	if err != nil {
+		t.Fatalf("unable to change keystore password. %s", err.Error())
+	}
+
+	_, err = ExportKeystoreAccount(tmpDir, acc, testKsPassword, "export")
+	if err == nil {
+		t.Fatalf("expected export with the old password to fail")
+	}
+
+	keyJson, err := ExportKeystoreAccount(tmpDir, acc, newPassword, "export")
+	if err != nil {
+		t.Fatalf("unable to export keystore account. %s", err.Error())
+	}
+
+	exportedKey, err := keystore.DecryptKey(keyJson, "export")
+	if err != nil {
+		t.Fatalf("unable to decrypt exported keystore JSON. %s", err.Error())
+	}
+
+	if !exportedKey.PrivateKey.Equal(key.PrivateKey) {
+		t.Fatalf("exported key doesn't match the imported private key")
+	}
+}
+
+func TestSignMessageCannotBeReplayedAsTx(t *testing.T) {
+	key, err := NewRandomKey()
+	if err != nil {
+		t.Fatalf("unable to create random key. %s", err.Error())
+	}
+
+	tx := database.NewTx(key.Address, database.NewAccount(database.DevJTangAccount), 100, 1, "")
+	rawTx, err := tx.Encode()
+	if err != nil {
+		t.Fatalf("unable to encode TX. %s", err.Error())
+	}
+
+	sig, err := SignMessage(rawTx, key.PrivateKey)
+	if err != nil {
+		t.Fatalf("unable to sign message. %s", err.Error())
+	}
+
+	signer, err := VerifyMessage(rawTx, sig)
+	if err != nil {
+		t.Fatalf("unable to verify message. %s", err.Error())
+	}
+
+	if signer != key.Address {
+		t.Fatalf("message was signed by %s but verified as %s", key.Address.Hex(), signer.Hex())
+	}
+
+	ok, err := database.NewSignedTx(tx, sig).IsSigAuthentic()
+	if err != nil {
+		t.Fatalf("unable to determine whether signature is authentic. %s", err.Error())
+	}
+
+	if ok {
+		t.Fatalf("message signature must not be accepted as a TX signature")
+	}
+}